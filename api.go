@@ -0,0 +1,528 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// apiRoutes serves the json api mounted at /api/v1, described by the OpenAPI document at /api/v1/openapi.json
+func apiRoutes(r chi.Router) {
+	r.NotFound(notFoundResponse)
+	r.MethodNotAllowed(methodNotAllowedResponse)
+
+	r.Get("/openapi.json", openAPIHandler)
+
+	r.Get("/sessions", listSessionsHandler)
+	r.Post("/sessions", createSessionHandler)
+	r.Get("/sessions/active", showActiveSessionHandler)
+	r.Post("/sessions/active", startActiveSessionHandler)
+	r.Delete("/sessions/active", endActiveSessionHandler)
+	r.Get("/sessions/{id}", showSessionHandler)
+	r.Patch("/sessions/{id}", updateSessionHandler)
+	r.Delete("/sessions/{id}", deleteSessionHandler)
+
+	r.Get("/activities", listActivitiesHandler)
+	r.Get("/reports/daily", dailyReportHandler)
+	r.Get("/reports/yearly", yearlyReportHandler)
+	r.Get("/heatmap", heatmapHandler)
+	r.Get("/segments", apiSegmentsHandler)
+}
+
+func openAPIHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Write([]byte(OPENAPI_JSON))
+}
+
+func newSessionResponse(session *Session) SessionResponse {
+	response := SessionResponse{
+		ID:       session.ID,
+		Date:     session.Date,
+		Activity: session.Activity,
+		Start:    session.Start.Format(time.RFC3339),
+		Active:   session.End.IsZero(),
+	}
+	end := session.End
+	if response.Active {
+		end = time.Now()
+	} else {
+		endStr := session.End.Format(time.RFC3339)
+		response.End = &endStr
+	}
+	response.Minutes = roundMinutes(end.Sub(session.Start).Minutes())
+	return response
+}
+
+// refreshChartData drops the cached charts showing the given dates after their sessions changed,
+// they are computed again when next requested
+func refreshChartData(dates ...string) {
+	charts.invalidateDates(dates...)
+}
+
+// parseDateParam parses a yyyy-mm-dd query parameter, defaulting to today when it's missing
+func parseDateParam(r *http.Request, name string) (string, error) {
+	date := strings.TrimSpace(r.URL.Query().Get(name))
+	if date == "" {
+		return time.Now().Format("2006-01-02"), nil
+	}
+	_, err := time.Parse("2006-01-02", date)
+	if err != nil {
+		return "", fmt.Errorf("invalid %s %q, expected yyyy-mm-dd", name, date)
+	}
+	return date, nil
+}
+
+func readIDParam(r *http.Request) (int64, error) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil || id < 1 {
+		return 0, errors.New("invalid id parameter")
+	}
+	return id, nil
+}
+
+// validateSession checks the fields of a session created or edited through the api, recording
+// what's wrong with each field in problems, unless the field already has a problem. A zero end
+// is only valid for the active session
+func validateSession(session Session, active bool, problems map[string]string) {
+	check := func(OK bool, field, message string) {
+		if _, exists := problems[field]; !OK && !exists {
+			problems[field] = message
+		}
+	}
+	check(session.Activity != "", "activity", "must be provided")
+	check(len(session.Activity) <= 100, "activity", "must not be more than 100 bytes long")
+	check(!session.Start.After(time.Now()), "start", "must not be in the future")
+	if session.End.IsZero() {
+		check(active, "end", "must be provided")
+		return
+	}
+	check(session.End.After(session.Start), "end", "must be after the start")
+	check(!session.End.After(time.Now()), "end", "must not be in the future")
+}
+
+// parseTimeField parses an RFC 3339 time of a request body into problems' field on failure
+func parseTimeField(value, field string, problems map[string]string) time.Time {
+	t, err := time.Parse(time.RFC3339, strings.TrimSpace(value))
+	if err != nil {
+		problems[field] = "must be an RFC 3339 time, e.g. 2026-10-18T09:00:00+02:00"
+		return time.Time{}
+	}
+	return t.Local()
+}
+
+func listSessionsHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	from, to, err := parseDateRange(strings.TrimSpace(query.Get("from")), strings.TrimSpace(query.Get("to")), 30)
+	if err != nil {
+		badRequestResponse(w, r, err)
+		return
+	}
+	sessions, err := getSessionsBetween(from, to, normalizeActivities(query["activity"]))
+	if err != nil {
+		serverErrorResponse(w, r, err)
+		return
+	}
+	responses := make([]SessionResponse, len(sessions))
+	for i := range sessions {
+		responses[i] = newSessionResponse(&sessions[i])
+	}
+	err = writeJSON(w, http.StatusOK, envelope{"sessions": responses, "from": from, "to": to}, nil)
+	if err != nil {
+		serverErrorResponse(w, r, err)
+	}
+}
+
+func createSessionHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Activity string `json:"activity"`
+		Start    string `json:"start"`
+		End      string `json:"end"`
+	}
+	err := readJSON(w, r, &input)
+	if err != nil {
+		badRequestResponse(w, r, err)
+		return
+	}
+
+	problems := make(map[string]string)
+	session := Session{
+		Activity: strings.TrimSpace(input.Activity),
+		Start:    parseTimeField(input.Start, "start", problems),
+		End:      parseTimeField(input.End, "end", problems),
+	}
+	validateSession(session, false, problems)
+	if len(problems) > 0 {
+		failedValidationResponse(w, r, problems)
+		return
+	}
+
+	created, err := addSession(session.Activity, session.Start, session.End)
+	if err != nil {
+		if errors.Is(err, ErrSessionOverlaps) {
+			conflictResponse(w, r, err)
+		} else {
+			serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	refreshChartData(created.Date)
+
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/api/v1/sessions/%d", created.ID))
+	err = writeJSON(w, http.StatusCreated, envelope{"session": newSessionResponse(created)}, headers)
+	if err != nil {
+		serverErrorResponse(w, r, err)
+	}
+}
+
+func showSessionHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := readIDParam(r)
+	if err != nil {
+		notFoundResponse(w, r)
+		return
+	}
+	session, err := getSession(id)
+	if err != nil {
+		if errors.Is(err, ErrSessionNotFound) {
+			notFoundResponse(w, r)
+		} else {
+			serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	err = writeJSON(w, http.StatusOK, envelope{"session": newSessionResponse(session)}, nil)
+	if err != nil {
+		serverErrorResponse(w, r, err)
+	}
+}
+
+// updateSessionHandler changes the fields given in the body, an active session can't be ended here
+func updateSessionHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := readIDParam(r)
+	if err != nil {
+		notFoundResponse(w, r)
+		return
+	}
+	session, err := getSession(id)
+	if err != nil {
+		if errors.Is(err, ErrSessionNotFound) {
+			notFoundResponse(w, r)
+		} else {
+			serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	var input struct {
+		Activity *string `json:"activity"`
+		Start    *string `json:"start"`
+		End      *string `json:"end"`
+	}
+	err = readJSON(w, r, &input)
+	if err != nil {
+		badRequestResponse(w, r, err)
+		return
+	}
+
+	active := session.End.IsZero()
+	problems := make(map[string]string)
+	if input.Activity != nil {
+		session.Activity = strings.TrimSpace(*input.Activity)
+	}
+	if input.Start != nil {
+		session.Start = parseTimeField(*input.Start, "start", problems)
+	}
+	if input.End != nil && active {
+		problems["end"] = "can't be set while the session is active, end it with DELETE /api/v1/sessions/active"
+	} else if input.End != nil {
+		session.End = parseTimeField(*input.End, "end", problems)
+	}
+	validateSession(*session, active, problems)
+	if len(problems) > 0 {
+		failedValidationResponse(w, r, problems)
+		return
+	}
+
+	previous, err := updateSession(*session)
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrSessionNotFound):
+			notFoundResponse(w, r)
+		case errors.Is(err, ErrSessionOverlaps):
+			conflictResponse(w, r, err)
+		default:
+			serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	session.Date = session.Start.Format("2006-01-02")
+	refreshChartData(previous.Date, session.Date)
+
+	err = writeJSON(w, http.StatusOK, envelope{"session": newSessionResponse(session)}, nil)
+	if err != nil {
+		serverErrorResponse(w, r, err)
+	}
+}
+
+func deleteSessionHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := readIDParam(r)
+	if err != nil {
+		notFoundResponse(w, r)
+		return
+	}
+	session, err := deleteSession(id)
+	if err != nil {
+		if errors.Is(err, ErrSessionNotFound) {
+			notFoundResponse(w, r)
+		} else {
+			serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	refreshChartData(session.Date)
+
+	err = writeJSON(w, http.StatusOK, envelope{"message": "the session has been deleted"}, nil)
+	if err != nil {
+		serverErrorResponse(w, r, err)
+	}
+}
+
+// showActiveSessionHandler returns the session in progress, null when there is none
+func showActiveSessionHandler(w http.ResponseWriter, r *http.Request) {
+	session, err := getActiveSession()
+	if err != nil {
+		serverErrorResponse(w, r, err)
+		return
+	}
+	var response *SessionResponse
+	if session != nil {
+		sr := newSessionResponse(session)
+		response = &sr
+	}
+	err = writeJSON(w, http.StatusOK, envelope{"session": response}, nil)
+	if err != nil {
+		serverErrorResponse(w, r, err)
+	}
+}
+
+func startActiveSessionHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Activity string `json:"activity"`
+	}
+	err := readJSON(w, r, &input)
+	if err != nil {
+		badRequestResponse(w, r, err)
+		return
+	}
+	activity := strings.TrimSpace(input.Activity)
+	problems := make(map[string]string)
+	validateSession(Session{Activity: activity, Start: time.Now()}, true, problems)
+	if len(problems) > 0 {
+		failedValidationResponse(w, r, problems)
+		return
+	}
+
+	activeActivity, err := startSession(activity)
+	if err != nil {
+		if err.Error() == ErrStartSession {
+			conflictResponse(w, r, fmt.Errorf("a session with activity %s is already in progress", activeActivity))
+		} else {
+			serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	session, err := getActiveSession()
+	if err != nil || session == nil {
+		serverErrorResponse(w, r, fmt.Errorf("the started session can't be read: %v", err))
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/api/v1/sessions/%d", session.ID))
+	err = writeJSON(w, http.StatusCreated, envelope{"session": newSessionResponse(session)}, headers)
+	if err != nil {
+		serverErrorResponse(w, r, err)
+	}
+}
+
+func endActiveSessionHandler(w http.ResponseWriter, r *http.Request) {
+	session, err := endActiveSession()
+	if err != nil {
+		if errors.Is(err, ErrSessionNotFound) {
+			errorResponse(w, r, http.StatusNotFound, ErrEndSession)
+		} else {
+			serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	refreshChartData(session.Date)
+
+	err = writeJSON(w, http.StatusOK, envelope{"session": newSessionResponse(session)}, nil)
+	if err != nil {
+		serverErrorResponse(w, r, err)
+	}
+}
+
+func listActivitiesHandler(w http.ResponseWriter, r *http.Request) {
+	activities, err := getActivities()
+	if err != nil {
+		serverErrorResponse(w, r, err)
+		return
+	}
+	err = writeJSON(w, http.StatusOK, envelope{"activities": activities}, nil)
+	if err != nil {
+		serverErrorResponse(w, r, err)
+	}
+}
+
+// activityMinutes sorts the minutes spent on each activity, longest first
+func activityMinutes(minutes map[string]float64) ([]ActivityMinutes, float64) {
+	activities := make([]ActivityMinutes, 0, len(minutes))
+	total := 0.0
+	for activity, m := range minutes {
+		activities = append(activities, ActivityMinutes{Activity: activity, Minutes: roundMinutes(m)})
+		total += m
+	}
+	sort.Slice(activities, func(i, j int) bool {
+		if activities[i].Minutes != activities[j].Minutes {
+			return activities[i].Minutes > activities[j].Minutes
+		}
+		return activities[i].Activity < activities[j].Activity
+	})
+	return activities, roundMinutes(total)
+}
+
+func dailyReportHandler(w http.ResponseWriter, r *http.Request) {
+	date, err := parseDateParam(r, "date")
+	if err != nil {
+		badRequestResponse(w, r, err)
+		return
+	}
+	minutes := make(map[string]float64)
+	err = forEachDailyTotalBetween(date, date, normalizeActivities(r.URL.Query()["activity"]), func(total ActivitySession) error {
+		minutes[total.Activity] += float64(total.Duration)
+		return nil
+	})
+	if err != nil {
+		serverErrorResponse(w, r, err)
+		return
+	}
+	report := DailyReport{Date: date}
+	report.Activities, report.TotalMinutes = activityMinutes(minutes)
+	err = writeJSON(w, http.StatusOK, envelope{"report": report}, nil)
+	if err != nil {
+		serverErrorResponse(w, r, err)
+	}
+}
+
+func yearlyReportHandler(w http.ResponseWriter, r *http.Request) {
+	year := strings.TrimSpace(r.URL.Query().Get("year"))
+	if year == "" {
+		year = strconv.Itoa(time.Now().Year())
+	}
+	y, err := strconv.Atoi(year)
+	if err != nil || y < 1 || y > 9999 {
+		badRequestResponse(w, r, fmt.Errorf("invalid year %q", year))
+		return
+	}
+
+	minutes := make(map[string]float64)
+	months := make([]MonthMinutes, 12)
+	for i := range months {
+		months[i].Month = fmt.Sprintf("%04d-%02d", y, i+1)
+	}
+	from, to := fmt.Sprintf("%04d-01-01", y), fmt.Sprintf("%04d-12-31", y)
+	err = forEachDailyTotalBetween(from, to, normalizeActivities(r.URL.Query()["activity"]), func(total ActivitySession) error {
+		minutes[total.Activity] += float64(total.Duration)
+		month, err := strconv.Atoi(total.Date[5:7])
+		if err != nil {
+			return err
+		}
+		months[month-1].Minutes += float64(total.Duration)
+		return nil
+	})
+	if err != nil {
+		serverErrorResponse(w, r, err)
+		return
+	}
+	for i := range months {
+		months[i].Minutes = roundMinutes(months[i].Minutes)
+	}
+	report := YearlyReport{Year: year, Months: months}
+	report.Activities, report.TotalMinutes = activityMinutes(minutes)
+	err = writeJSON(w, http.StatusOK, envelope{"report": report}, nil)
+	if err != nil {
+		serverErrorResponse(w, r, err)
+	}
+}
+
+func heatmapHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	year := strings.TrimSpace(query.Get("year"))
+	if year == "" {
+		year = ROLLING_YEAR
+	}
+	if _, _, _, err := chartWindow(year, time.Now()); err != nil {
+		badRequestResponse(w, r, fmt.Errorf("invalid year %q, expected a year or %s", year, ROLLING_YEAR))
+		return
+	}
+	chartData, err := getChartData(year, query["activity"])
+	if err != nil {
+		serverErrorResponse(w, r, err)
+		return
+	}
+
+	response := HeatmapResponse{
+		Year:       chartData.Year,
+		Title:      chartData.Title,
+		From:       chartData.From,
+		To:         chartData.To,
+		WeekStart:  chartData.WeekStart,
+		Activities: chartData.Activities,
+		Days:       make([]HeatmapDay, 0, len(chartData.Weeks)*7),
+	}
+	if response.Activities == nil {
+		response.Activities = []string{}
+	}
+	for _, week := range chartData.Weeks {
+		for _, day := range week {
+			if day == nil {
+				continue
+			}
+			activities := make(map[string]float64, len(day.Activities))
+			for activity, sd := range day.Activities {
+				activities[activity] = roundMinutes(float64(sd.Minutes))
+			}
+			response.Days = append(response.Days, HeatmapDay{Date: day.Date, Level: day.Level, TotalHours: math.Round(float64(day.TotalHours)*100) / 100, Activities: activities})
+		}
+	}
+
+	err = writeJSON(w, http.StatusOK, envelope{"heatmap": response}, nil)
+	if err != nil {
+		serverErrorResponse(w, r, err)
+	}
+}
+
+func apiSegmentsHandler(w http.ResponseWriter, r *http.Request) {
+	date, err := parseDateParam(r, "date")
+	if err != nil {
+		badRequestResponse(w, r, err)
+		return
+	}
+	segments, err := getSegmentsFor(date)
+	if err != nil {
+		serverErrorResponse(w, r, err)
+		return
+	}
+	err = writeJSON(w, http.StatusOK, envelope{"segments": segments}, nil)
+	if err != nil {
+		serverErrorResponse(w, r, err)
+	}
+}
@@ -0,0 +1,267 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// apiRequest sends a json body, when there is one, to an api route
+func apiRequest(t *testing.T, handler http.Handler, method, target, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	r := httptest.NewRequest(method, "/api/v1"+target, strings.NewReader(body))
+	if body != "" {
+		r.Header.Set("Content-Type", "application/json")
+	}
+	return doRequest(handler, r)
+}
+
+// decodeResponse reads the json body of w into v, after checking the status
+func decodeResponse(t *testing.T, w *httptest.ResponseRecorder, status int, v any) {
+	t.Helper()
+	if w.Code != status {
+		t.Fatalf("answered %d, want %d: %s", w.Code, status, w.Body)
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), v); err != nil {
+		t.Fatalf("decoding %s: %v", w.Body, err)
+	}
+}
+
+func sessionBody(activity string, start, end time.Time) string {
+	return fmt.Sprintf(`{"activity": %q, "start": %q, "end": %q}`, activity, start.Format(time.RFC3339), end.Format(time.RFC3339))
+}
+
+func TestCreateSessionValidatesItsBody(t *testing.T) {
+	useTestDB(t)
+	handler := routes(ServerConfig{})
+	start := time.Now().Add(-48 * time.Hour).Truncate(time.Hour)
+
+	cases := []struct {
+		name, body string
+		problems   []string
+	}{
+		{"missing fields", `{}`, []string{"activity", "start", "end"}},
+		{"invalid times", `{"activity": "reading", "start": "yesterday", "end": "2026-10-18 10:00"}`, []string{"start", "end"}},
+		{"end before start", sessionBody("reading", start, start.Add(-time.Hour)), []string{"end"}},
+		{"future", sessionBody("reading", time.Now().Add(time.Hour), time.Now().Add(2*time.Hour)), []string{"start", "end"}},
+		{"long activity", sessionBody(strings.Repeat("a", 101), start, start.Add(time.Hour)), []string{"activity"}},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var response struct {
+				Error map[string]string `json:"error"`
+			}
+			decodeResponse(t, apiRequest(t, handler, http.MethodPost, "/sessions", c.body), http.StatusUnprocessableEntity, &response)
+			if len(response.Error) != len(c.problems) {
+				t.Errorf("got the problems %v, want problems with %v", response.Error, c.problems)
+			}
+			for _, field := range c.problems {
+				if response.Error[field] == "" {
+					t.Errorf("got no problem with %s in %v", field, response.Error)
+				}
+			}
+		})
+	}
+
+	if w := apiRequest(t, handler, http.MethodPost, "/sessions", `{"activity": "reading", "note": ""}`); w.Code != http.StatusBadRequest {
+		t.Errorf("a body with an unknown field answered %d, want %d", w.Code, http.StatusBadRequest)
+	}
+	if w := apiRequest(t, handler, http.MethodPost, "/sessions", `{"activity": "reading"`); w.Code != http.StatusBadRequest {
+		t.Errorf("a truncated body answered %d, want %d", w.Code, http.StatusBadRequest)
+	}
+	r := httptest.NewRequest(http.MethodPost, "/api/v1/sessions", strings.NewReader(sessionBody("reading", start, start.Add(time.Hour))))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if w := doRequest(handler, r); w.Code != http.StatusUnsupportedMediaType {
+		t.Errorf("a form body answered %d, want %d", w.Code, http.StatusUnsupportedMediaType)
+	}
+	if sessions := dumpSessions(t); sessions != "" {
+		t.Errorf("invalid bodies recorded sessions:\n%s", sessions)
+	}
+}
+
+func TestCreateSession(t *testing.T) {
+	useTestDB(t)
+	handler := routes(ServerConfig{})
+	start := time.Now().Add(-48 * time.Hour).Truncate(time.Hour)
+
+	w := apiRequest(t, handler, http.MethodPost, "/sessions", sessionBody(" reading ", start, start.Add(90*time.Minute)))
+	var created struct {
+		Session SessionResponse `json:"session"`
+	}
+	decodeResponse(t, w, http.StatusCreated, &created)
+	if location := w.Header().Get("Location"); location != fmt.Sprintf("/api/v1/sessions/%d", created.Session.ID) {
+		t.Errorf("got the location %q for the session %d", location, created.Session.ID)
+	}
+	if created.Session.Activity != "reading" || created.Session.Minutes != 90 || created.Session.Active {
+		t.Errorf("got the session %+v", created.Session)
+	}
+
+	var shown struct {
+		Session SessionResponse `json:"session"`
+	}
+	decodeResponse(t, apiRequest(t, handler, http.MethodGet, w.Header().Get("Location")[len("/api/v1"):], ""), http.StatusOK, &shown)
+	if shown.Session.ID != created.Session.ID || shown.Session.Start != created.Session.Start || *shown.Session.End != *created.Session.End {
+		t.Errorf("GET the created session returned %+v, want %+v", shown.Session, created.Session)
+	}
+
+	overlapping := sessionBody("writing", start.Add(time.Hour), start.Add(2*time.Hour))
+	if w := apiRequest(t, handler, http.MethodPost, "/sessions", overlapping); w.Code != http.StatusConflict {
+		t.Errorf("an overlapping session answered %d, want %d", w.Code, http.StatusConflict)
+	}
+	if w := apiRequest(t, handler, http.MethodGet, "/sessions/999", ""); w.Code != http.StatusNotFound {
+		t.Errorf("GET a missing session answered %d, want %d", w.Code, http.StatusNotFound)
+	}
+}
+
+func TestStartAndEndActiveSession(t *testing.T) {
+	useTestDB(t)
+	handler := routes(ServerConfig{})
+
+	var active struct {
+		Session *SessionResponse `json:"session"`
+	}
+	decodeResponse(t, apiRequest(t, handler, http.MethodGet, "/sessions/active", ""), http.StatusOK, &active)
+	if active.Session != nil {
+		t.Fatalf("got the active session %+v before starting one", active.Session)
+	}
+	if w := apiRequest(t, handler, http.MethodDelete, "/sessions/active", ""); w.Code != http.StatusNotFound {
+		t.Errorf("ending without an active session answered %d, want %d", w.Code, http.StatusNotFound)
+	}
+	if w := apiRequest(t, handler, http.MethodPost, "/sessions/active", `{"activity": " "}`); w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("starting without an activity answered %d, want %d", w.Code, http.StatusUnprocessableEntity)
+	}
+
+	w := apiRequest(t, handler, http.MethodPost, "/sessions/active", `{"activity": "reading"}`)
+	var started struct {
+		Session SessionResponse `json:"session"`
+	}
+	decodeResponse(t, w, http.StatusCreated, &started)
+	if !started.Session.Active || started.Session.Activity != "reading" || started.Session.End != nil {
+		t.Errorf("got the started session %+v", started.Session)
+	}
+	if w := apiRequest(t, handler, http.MethodPost, "/sessions/active", `{"activity": "writing"}`); w.Code != http.StatusConflict {
+		t.Errorf("starting a second session answered %d, want %d", w.Code, http.StatusConflict)
+	}
+	decodeResponse(t, apiRequest(t, handler, http.MethodGet, "/sessions/active", ""), http.StatusOK, &active)
+	if active.Session == nil || active.Session.ID != started.Session.ID {
+		t.Errorf("got the active session %+v, want the session %d", active.Session, started.Session.ID)
+	}
+
+	var ended struct {
+		Session SessionResponse `json:"session"`
+	}
+	decodeResponse(t, apiRequest(t, handler, http.MethodDelete, "/sessions/active", ""), http.StatusOK, &ended)
+	if ended.Session.ID != started.Session.ID || ended.Session.Active || ended.Session.End == nil {
+		t.Errorf("got the ended session %+v, want the session %d ended", ended.Session, started.Session.ID)
+	}
+	if w := apiRequest(t, handler, http.MethodDelete, "/sessions/active", ""); w.Code != http.StatusNotFound {
+		t.Errorf("ending the session twice answered %d, want %d", w.Code, http.StatusNotFound)
+	}
+}
+
+func TestEndActiveSessionOnce(t *testing.T) {
+	useTestDB(t)
+	if _, err := endActiveSession(); err != ErrSessionNotFound {
+		t.Fatalf("ending without an active session returned %v, want %v", err, ErrSessionNotFound)
+	}
+	if _, err := startSession("reading"); err != nil {
+		t.Fatal(err)
+	}
+
+	const ends = 8
+	errs := make(chan error, ends)
+	for range ends {
+		go func() {
+			_, err := endActiveSession()
+			errs <- err
+		}()
+	}
+	ended := 0
+	for range ends {
+		switch err := <-errs; err {
+		case nil:
+			ended++
+		case ErrSessionNotFound:
+		default:
+			t.Error(err)
+		}
+	}
+	if ended != 1 {
+		t.Errorf("the session was ended %d times, want once", ended)
+	}
+}
+
+func TestUpdateSession(t *testing.T) {
+	useTestDB(t)
+	handler := routes(ServerConfig{})
+	start := time.Now().Add(-48 * time.Hour).Truncate(time.Hour)
+	session := mustAddSession(t, "reading", start, 60)
+	mustAddSession(t, "writing", start.Add(2*time.Hour), 60)
+	target := fmt.Sprintf("/sessions/%d", session.ID)
+
+	var updated struct {
+		Session SessionResponse `json:"session"`
+	}
+	body := fmt.Sprintf(`{"activity": "studying", "end": %q}`, start.Add(30*time.Minute).Format(time.RFC3339))
+	decodeResponse(t, apiRequest(t, handler, http.MethodPatch, target, body), http.StatusOK, &updated)
+	if updated.Session.Activity != "studying" || updated.Session.Minutes != 30 {
+		t.Errorf("got the updated session %+v", updated.Session)
+	}
+	if edited, err := getSession(session.ID); err != nil || edited.Activity != "studying" || !edited.End.Equal(start.Add(30*time.Minute)) {
+		t.Errorf("the session was saved as %+v (%v)", edited, err)
+	}
+
+	cases := []struct {
+		name, target, body string
+		status             int
+	}{
+		{"end before start", target, fmt.Sprintf(`{"end": %q}`, start.Add(-time.Hour).Format(time.RFC3339)), http.StatusUnprocessableEntity},
+		{"empty activity", target, `{"activity": ""}`, http.StatusUnprocessableEntity},
+		{"overlapping", target, fmt.Sprintf(`{"end": %q}`, start.Add(150*time.Minute).Format(time.RFC3339)), http.StatusConflict},
+		{"unknown field", target, `{"note": "x"}`, http.StatusBadRequest},
+		{"missing session", "/sessions/999", `{"activity": "writing"}`, http.StatusNotFound},
+		{"invalid id", "/sessions/abc", `{"activity": "writing"}`, http.StatusNotFound},
+	}
+	before := dumpSessions(t)
+	for _, c := range cases {
+		if w := apiRequest(t, handler, http.MethodPatch, c.target, c.body); w.Code != c.status {
+			t.Errorf("%s: PATCH %s answered %d, want %d: %s", c.name, c.target, w.Code, c.status, w.Body)
+		}
+	}
+	if after := dumpSessions(t); after != before {
+		t.Errorf("rejected edits changed the sessions from\n%s\nto\n%s", before, after)
+	}
+
+	if _, err := startSession("programming"); err != nil {
+		t.Fatal(err)
+	}
+	active, err := getActiveSession()
+	if err != nil || active == nil {
+		t.Fatalf("reading the active session: %v", err)
+	}
+	body = fmt.Sprintf(`{"end": %q}`, time.Now().Format(time.RFC3339))
+	if w := apiRequest(t, handler, http.MethodPatch, fmt.Sprintf("/sessions/%d", active.ID), body); w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("ending the active session with PATCH answered %d, want %d", w.Code, http.StatusUnprocessableEntity)
+	}
+}
+
+func TestDeleteSession(t *testing.T) {
+	useTestDB(t)
+	handler := routes(ServerConfig{})
+	session := mustAddSession(t, "reading", time.Now().Add(-48*time.Hour), 60)
+	target := fmt.Sprintf("/sessions/%d", session.ID)
+
+	if w := apiRequest(t, handler, http.MethodDelete, target, ""); w.Code != http.StatusOK {
+		t.Errorf("DELETE %s answered %d, want %d", target, w.Code, http.StatusOK)
+	}
+	if w := apiRequest(t, handler, http.MethodDelete, target, ""); w.Code != http.StatusNotFound {
+		t.Errorf("deleting the session twice answered %d, want %d", w.Code, http.StatusNotFound)
+	}
+	if sessions := dumpSessions(t); sessions != "" {
+		t.Errorf("the session wasn't deleted:\n%s", sessions)
+	}
+}
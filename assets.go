@@ -0,0 +1,285 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"embed"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"html/template"
+	"io/fs"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	texttemplate "text/template"
+	"time"
+)
+
+// htmx is vendored into static by go generate, the pinned release being built into the binary
+//go:generate curl -fsSL -o static/htmx.min.js https://unpkg.com/htmx.org@2.0.8/dist/htmx.min.js
+
+// the templates and the stylesheets and scripts of the dashboard are built into the binary,
+// so that it works offline and from any directory
+//
+//go:embed templates static
+var embeddedFiles embed.FS
+
+// staticAsset is a file served under /static, its name embedding a hash of its content
+// so that it can be cached forever and still be reloaded once it changes
+type staticAsset struct {
+	Name       string
+	HashedName string
+	// first 10 hex digits of the sha256 of Content
+	Hash    string
+	Content []byte
+}
+
+// themeFS is the files the templates and static assets are read from, the embedded ones
+// overlaid with those of the theme_dir setting once loadTheme ran
+var themeFS fs.FS = embeddedFiles
+
+// the theme set with config set theme, guarded by currentThemeMu as the server reads it again
+// when the database changes
+var (
+	currentTheme   string
+	currentThemeMu sync.RWMutex
+)
+
+// staticAssets by name and by hashed name, names of the subdirectories included e.g. themes/dark.css
+var staticAssets = mustLoadStaticAssets(embeddedFiles)
+
+func mustLoadStaticAssets(fsys fs.FS) map[string]*staticAsset {
+	assets, err := loadStaticAssets(fsys)
+	if err != nil {
+		panic(err)
+	}
+	return assets
+}
+
+func loadStaticAssets(fsys fs.FS) (map[string]*staticAsset, error) {
+	assets := make(map[string]*staticAsset)
+	err := fs.WalkDir(fsys, "static", func(file string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() {
+			return err
+		}
+		content, err := fs.ReadFile(fsys, file)
+		if err != nil {
+			return err
+		}
+		sum := sha256.Sum256(content)
+		asset := &staticAsset{Name: strings.TrimPrefix(file, "static/"), Hash: hex.EncodeToString(sum[:])[:10], Content: content}
+		// the hash goes before the extension, e.g. home.0a1b2c3d4e.css
+		ext := path.Ext(asset.Name)
+		asset.HashedName = strings.TrimSuffix(asset.Name, ext) + "." + asset.Hash + ext
+		assets[asset.Name] = asset
+		assets[asset.HashedName] = asset
+		return nil
+	})
+	return assets, err
+}
+
+// overlayFS reads the files of dir, falling back to those of base it doesn't have
+type overlayFS struct {
+	dir  fs.FS
+	base fs.FS
+}
+
+func (o overlayFS) Open(name string) (fs.File, error) {
+	f, err := o.dir.Open(name)
+	if errors.Is(err, fs.ErrNotExist) {
+		return o.base.Open(name)
+	}
+	return f, err
+}
+
+// ReadDir lists the files of both, so that a theme directory can add stylesheets as well as replace them
+func (o overlayFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	baseEntries, baseErr := fs.ReadDir(o.base, name)
+	if baseErr != nil && !errors.Is(baseErr, fs.ErrNotExist) {
+		return nil, baseErr
+	}
+	dirEntries, dirErr := fs.ReadDir(o.dir, name)
+	if dirErr != nil && !errors.Is(dirErr, fs.ErrNotExist) {
+		return nil, dirErr
+	}
+	if baseErr != nil && dirErr != nil {
+		return nil, baseErr
+	}
+
+	byName := make(map[string]fs.DirEntry)
+	for _, entry := range baseEntries {
+		byName[entry.Name()] = entry
+	}
+	for _, entry := range dirEntries {
+		byName[entry.Name()] = entry
+	}
+	entries := make([]fs.DirEntry, 0, len(byName))
+	for _, entry := range byName {
+		entries = append(entries, entry)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+	return entries, nil
+}
+
+// newThemeFS overlays the embedded files with those of dir, laid out the same way: templates/home.html,
+// static/home.css, static/themes/<theme>.css...
+func newThemeFS(dir string) (fs.FS, error) {
+	if dir == "" {
+		return embeddedFiles, nil
+	}
+	info, err := os.Stat(dir)
+	if err != nil {
+		return nil, fmt.Errorf("theme directory: %v", err)
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("theme directory: %s is not a directory", dir)
+	}
+	return overlayFS{dir: os.DirFS(dir), base: embeddedFiles}, nil
+}
+
+// loadTheme reads the static assets from the theme directory set with config set theme_dir,
+// which is only read on startup, and the theme set with config set theme
+func loadTheme() error {
+	dir, err := getSetting(SETTING_THEME_DIR)
+	if err != nil {
+		return err
+	}
+	fsys, err := newThemeFS(dir)
+	if err != nil {
+		return err
+	}
+	assets, err := loadStaticAssets(fsys)
+	if err != nil {
+		return err
+	}
+	themeFS = fsys
+	staticAssets = assets
+	return setCurrentTheme()
+}
+
+// setCurrentTheme reads the theme the pages are rendered with from the settings
+func setCurrentTheme() error {
+	theme, err := getSetting(SETTING_THEME)
+	if err != nil {
+		return err
+	}
+	currentThemeMu.Lock()
+	currentTheme = theme
+	currentThemeMu.Unlock()
+	return nil
+}
+
+// getCurrentTheme returns the theme as of the last setCurrentTheme
+func getCurrentTheme() string {
+	currentThemeMu.RLock()
+	defer currentThemeMu.RUnlock()
+	return currentTheme
+}
+
+// writeThemeDir copies the embedded templates and static assets to dir as a starting point for a theme,
+// leaving the files already there untouched. It returns the number of files written
+func writeThemeDir(dir string) (int, error) {
+	written := 0
+	err := fs.WalkDir(embeddedFiles, ".", func(file string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dir, filepath.FromSlash(file))
+		if entry.IsDir() {
+			return os.MkdirAll(target, 0755)
+		}
+		if _, err := os.Stat(target); err == nil {
+			return nil
+		}
+		content, err := fs.ReadFile(embeddedFiles, file)
+		if err != nil {
+			return err
+		}
+		written++
+		return os.WriteFile(target, content, 0644)
+	})
+	return written, err
+}
+
+// themeNames lists the themes available in fsys, one per stylesheet of static/themes
+func themeNames(fsys fs.FS) ([]string, error) {
+	entries, err := fs.ReadDir(fsys, "static/themes")
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		if !entry.IsDir() && path.Ext(entry.Name()) == ".css" {
+			names = append(names, strings.TrimSuffix(entry.Name(), ".css"))
+		}
+	}
+	return names, nil
+}
+
+// themeStylesheet is the url of the stylesheet of the theme set with config set theme,
+// the light one when it isn't available
+func themeStylesheet() string {
+	theme := getCurrentTheme()
+	if _, OK := staticAssets["themes/"+theme+".css"]; !OK {
+		theme = settingDefaults[SETTING_THEME]
+	}
+	return assetPath("themes/" + theme + ".css")
+}
+
+// assetPath is the url of a static asset, relative so that it also works from the pages of build-site
+func assetPath(name string) string {
+	asset, OK := staticAssets[name]
+	if !OK {
+		return "static/" + name
+	}
+	return "static/" + asset.HashedName
+}
+
+// htmxScript is the url of htmx, or of hx.js implementing the part of it the dashboard uses
+// for trees where htmx.min.js hasn't been vendored yet
+func htmxScript() string {
+	if _, OK := staticAssets["htmx.min.js"]; OK {
+		return assetPath("htmx.min.js")
+	}
+	return assetPath("hx.js")
+}
+
+// staticHandler serves the static assets, the hashed names being cached for a year
+func staticHandler(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimPrefix(r.URL.Path, "/static/")
+	asset, OK := staticAssets[name]
+	if !OK {
+		http.NotFound(w, r)
+		return
+	}
+	if name == asset.HashedName {
+		w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+	} else {
+		w.Header().Set("Cache-Control", "no-cache")
+	}
+	w.Header().Set("ETag", `"`+asset.Hash+`"`)
+	http.ServeContent(w, r, asset.Name, time.Time{}, bytes.NewReader(asset.Content))
+}
+
+// parseTemplates parses the given files of the templates directory, the first one being executed
+func parseTemplates(files ...string) (*template.Template, error) {
+	paths := make([]string, len(files))
+	for i, file := range files {
+		paths[i] = path.Join("templates", file)
+	}
+	return template.New(files[0]).Funcs(funcMap).ParseFS(themeFS, paths...)
+}
+
+// parseTextTemplates parses templates whose output isn't html, like parseTemplates but without escaping
+func parseTextTemplates(files ...string) (*texttemplate.Template, error) {
+	paths := make([]string, len(files))
+	for i, file := range files {
+		paths[i] = path.Join("templates", file)
+	}
+	return texttemplate.New(files[0]).Funcs(funcMap).ParseFS(themeFS, paths...)
+}
@@ -0,0 +1,365 @@
+package main
+
+import (
+	"context"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// With --auth every request must carry an api token, as a bearer token or, for the calendar and badge
+// feeds, a token query parameter, or the cookie of a login session opened with the password.
+// Tokens and login sessions are random secrets stored as sha256 hashes, the password is hashed with PBKDF2
+const (
+	passwordSettingKey = "password_hash"
+	loginCookieName    = "gotimeit_session"
+	loginSessionLength = 30 * 24 * time.Hour
+	passwordIterations = 600000
+	// how precisely the last use of api tokens is recorded
+	apiTokenUsageResolution = time.Minute
+	// login attempts allowed over loginAttemptsWindow from one client
+	maxClientLoginAttempts = 5
+	loginAttemptsWindow    = 15 * time.Minute
+)
+
+// set by serve when the server requires authentication
+var authRequired bool
+
+var loginAttempts = newLoginLimiter(maxClientLoginAttempts, loginAttemptsWindow)
+
+// loginLimiter limits the login attempts per client, so that guessing the password doesn't get faster by
+// sending many requests at once. There is no limit over all clients, which anyone could exhaust to lock the
+// owner out. An attempt counts as soon as it starts, so that concurrent guesses can't all pass before the
+// first one fails, and the attempts of a client are forgotten once it logs in
+type loginLimiter struct {
+	mu        sync.Mutex
+	perClient int
+	window    time.Duration
+	// the attempts within the window, oldest first
+	attempts []loginAttempt
+}
+
+type loginAttempt struct {
+	client string
+	at     time.Time
+}
+
+func newLoginLimiter(perClient int, window time.Duration) *loginLimiter {
+	return &loginLimiter{perClient: perClient, window: window}
+}
+
+// begin records an attempt of client, or returns how long to wait when it's over the limit
+func (l *loginLimiter) begin(client string, now time.Time) (time.Duration, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	i := 0
+	for i < len(l.attempts) && now.Sub(l.attempts[i].at) >= l.window {
+		i++
+	}
+	l.attempts = l.attempts[i:]
+
+	var clientAttempts []loginAttempt
+	for _, attempt := range l.attempts {
+		if attempt.client == client {
+			clientAttempts = append(clientAttempts, attempt)
+		}
+	}
+	if len(clientAttempts) >= l.perClient {
+		return clientAttempts[0].at.Add(l.window).Sub(now), false
+	}
+	l.attempts = append(l.attempts, loginAttempt{client: client, at: now})
+	return 0, true
+}
+
+// succeeded forgets the attempts of client, who knows the password
+func (l *loginLimiter) succeeded(client string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	kept := l.attempts[:0]
+	for _, attempt := range l.attempts {
+		if attempt.client != client {
+			kept = append(kept, attempt)
+		}
+	}
+	l.attempts = kept
+}
+
+// loginClient identifies the client of a request by its address, without the port
+func loginClient(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+type contextKey string
+
+// set on requests authenticated with an api token, which browsers never send on their own
+const bearerAuthenticatedKey = contextKey("bearerAuthenticated")
+
+// feeds read by calendar apps and image embeds, which can't send headers, take the token in the url
+var tokenQueryPaths = map[string]bool{"/calendar.ics": true, "/badge.svg": true}
+
+// newSecret returns a random token, prefixed to tell what it's for
+func newSecret(prefix string) (string, error) {
+	b := make([]byte, 32)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+	return prefix + base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// resolveAPIToken finds the token named nameOrID, or whose id it is, failing when it could be either of two tokens
+func resolveAPIToken(tokens []APIToken, nameOrID string) (APIToken, error) {
+	var byName, byID *APIToken
+	for i := range tokens {
+		if tokens[i].Name == nameOrID {
+			byName = &tokens[i]
+		}
+		if strconv.FormatInt(tokens[i].ID, 10) == nameOrID {
+			byID = &tokens[i]
+		}
+	}
+	switch {
+	case byName != nil && byID != nil && byName.ID != byID.ID:
+		return APIToken{}, fmt.Errorf("%s is both the name of token %d and the id of token %s, use --id or --name", nameOrID, byName.ID, byID.Name)
+	case byName != nil:
+		return *byName, nil
+	case byID != nil:
+		return *byID, nil
+	}
+	return APIToken{}, fmt.Errorf("no token named %s or with id %s", nameOrID, nameOrID)
+}
+
+func hashSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// hashPassword encodes the PBKDF2 hash of password with its parameters, as pbkdf2-sha256$iterations$salt$hash
+func hashPassword(password string) (string, error) {
+	salt := make([]byte, 16)
+	_, err := rand.Read(salt)
+	if err != nil {
+		return "", err
+	}
+	key, err := pbkdf2.Key(sha256.New, password, salt, passwordIterations, 32)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("pbkdf2-sha256$%d$%s$%s", passwordIterations,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+func checkPassword(password, encoded string) bool {
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 4 || parts[0] != "pbkdf2-sha256" {
+		return false
+	}
+	iterations, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return false
+	}
+	salt, err := base64.RawStdEncoding.DecodeString(parts[2])
+	if err != nil {
+		return false
+	}
+	expected, err := base64.RawStdEncoding.DecodeString(parts[3])
+	if err != nil {
+		return false
+	}
+	key, err := pbkdf2.Key(sha256.New, password, salt, iterations, len(expected))
+	if err != nil {
+		return false
+	}
+	return subtle.ConstantTimeCompare(key, expected) == 1
+}
+
+// checkCredentialsExist fails when authentication is required but nobody could log in
+func checkCredentialsExist() error {
+	password, err := getSetting(passwordSettingKey)
+	if err != nil {
+		return err
+	}
+	tokens, err := getAPITokens()
+	if err != nil {
+		return err
+	}
+	if password == "" && len(tokens) == 0 {
+		return errors.New("--auth needs a password (gotimeit password set) or an api token (gotimeit token create)")
+	}
+	return nil
+}
+
+// authenticate rejects requests without valid credentials, sending browsers to the login page
+func authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// the login page needs its stylesheet, the static assets being the same for everyone
+		if r.URL.Path == "/login" || strings.HasPrefix(r.URL.Path, "/static/") {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		token := ""
+		if scheme, value, OK := strings.Cut(r.Header.Get("Authorization"), " "); OK && strings.EqualFold(scheme, "Bearer") {
+			token = strings.TrimSpace(value)
+		} else if r.Method == http.MethodGet && tokenQueryPaths[r.URL.Path] {
+			token = r.URL.Query().Get("token")
+		}
+		if token != "" {
+			OK, err := useAPIToken(hashSecret(token))
+			if err != nil {
+				serverErrorResponse(w, r, err)
+				return
+			}
+			if !OK {
+				unauthorizedResponse(w, r, "invalid or revoked api token")
+				return
+			}
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), bearerAuthenticatedKey, true)))
+			return
+		}
+
+		if cookie, err := r.Cookie(loginCookieName); err == nil {
+			OK, err := loginSessionExists(hashSecret(cookie.Value))
+			if err != nil {
+				serverErrorResponse(w, r, err)
+				return
+			}
+			if OK {
+				next.ServeHTTP(w, r)
+				return
+			}
+		}
+		unauthorizedResponse(w, r, "authentication required")
+	})
+}
+
+func isBearerAuthenticated(r *http.Request) bool {
+	OK, _ := r.Context().Value(bearerAuthenticatedKey).(bool)
+	return OK
+}
+
+// unauthorizedResponse answers the json api with an error, htmx with a redirection it follows and
+// browsers navigating to a page with the login page
+func unauthorizedResponse(w http.ResponseWriter, r *http.Request, message string) {
+	switch {
+	case strings.HasPrefix(r.URL.Path, "/api/"):
+		w.Header().Set("WWW-Authenticate", `Bearer realm="gotimeit"`)
+		errorResponse(w, r, http.StatusUnauthorized, message)
+	case r.Header.Get("HX-Request") != "":
+		w.Header().Set("HX-Redirect", "/login")
+		http.Error(w, message, http.StatusUnauthorized)
+	case r.Method == http.MethodGet && !tokenQueryPaths[r.URL.Path]:
+		http.Redirect(w, r, "/login?next="+url.QueryEscape(r.URL.RequestURI()), http.StatusSeeOther)
+	default:
+		http.Error(w, message, http.StatusUnauthorized)
+	}
+}
+
+// safeRedirect keeps redirections after login on this server
+func safeRedirect(next string) string {
+	if !strings.HasPrefix(next, "/") || strings.HasPrefix(next, "//") || strings.HasPrefix(next, "/\\") {
+		return "/"
+	}
+	return next
+}
+
+func loginHandler(w http.ResponseWriter, r *http.Request) {
+	data := LoginData{Next: safeRedirect(r.FormValue("next"))}
+	var err error
+	data.CSRFToken, err = csrfToken(w, r)
+	if err != nil {
+		log.Println(err.Error())
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	status := http.StatusOK
+	if r.Method == http.MethodPost {
+		client := loginClient(r)
+		wait, OK := loginAttempts.begin(client, time.Now())
+		if !OK {
+			minutes := int(wait.Minutes()) + 1
+			w.Header().Set("Retry-After", strconv.Itoa(int(wait.Seconds())+1))
+			data.Error = fmt.Sprintf("Too many login attempts, try again in %d minute(s)", minutes)
+			renderLoginPage(w, &data, http.StatusTooManyRequests)
+			return
+		}
+		hash, err := getSetting(passwordSettingKey)
+		if err != nil {
+			log.Println(err.Error())
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		if hash != "" && checkPassword(r.PostFormValue("password"), hash) {
+			secret, err := newSecret("")
+			if err == nil {
+				err = addLoginSession(hashSecret(secret), time.Now().Add(loginSessionLength))
+			}
+			if err != nil {
+				log.Println(err.Error())
+				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+				return
+			}
+			loginAttempts.succeeded(client)
+			http.SetCookie(w, &http.Cookie{
+				Name:     loginCookieName,
+				Value:    secret,
+				Path:     "/",
+				MaxAge:   int(loginSessionLength.Seconds()),
+				HttpOnly: true,
+				Secure:   r.TLS != nil,
+				SameSite: http.SameSiteLaxMode,
+			})
+			http.Redirect(w, r, data.Next, http.StatusSeeOther)
+			return
+		}
+		data.Error = "Wrong password"
+		status = http.StatusUnauthorized
+	}
+	renderLoginPage(w, &data, status)
+}
+
+func renderLoginPage(w http.ResponseWriter, data *LoginData, status int) {
+	loginBytes, err := renderLogin(data)
+	if err != nil {
+		log.Println(err.Error())
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(status)
+	w.Write(loginBytes)
+}
+
+func logoutHandler(w http.ResponseWriter, r *http.Request) {
+	if cookie, err := r.Cookie(loginCookieName); err == nil {
+		err = deleteLoginSession(hashSecret(cookie.Value))
+		if err != nil {
+			log.Println(err.Error())
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+	}
+	http.SetCookie(w, &http.Cookie{Name: loginCookieName, Value: "", Path: "/", MaxAge: -1, HttpOnly: true})
+	if r.Header.Get("HX-Request") != "" {
+		w.Header().Set("HX-Redirect", "/login")
+		return
+	}
+	http.Redirect(w, r, "/login", http.StatusSeeOther)
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestResolveAPIToken(t *testing.T) {
+	tokens := []APIToken{{ID: 1, Name: "laptop"}, {ID: 2, Name: "phone"}, {ID: 3, Name: "2"}, {ID: 4, Name: "4"}}
+	cases := []struct {
+		nameOrID string
+		id       int64
+		fails    bool
+	}{
+		{"laptop", 1, false},
+		{"1", 1, false},
+		// named like its own id
+		{"4", 4, false},
+		// the name of token 3 and the id of token 2
+		{"2", 0, true},
+		{"tablet", 0, true},
+	}
+	for _, c := range cases {
+		token, err := resolveAPIToken(tokens, c.nameOrID)
+		if c.fails {
+			if err == nil {
+				t.Errorf("%s resolved to token %d, want an error", c.nameOrID, token.ID)
+			}
+			continue
+		}
+		if err != nil || token.ID != c.id {
+			t.Errorf("%s resolved to token %d (%v), want %d", c.nameOrID, token.ID, err, c.id)
+		}
+	}
+}
+
+func TestUseAPITokenThrottlesWrites(t *testing.T) {
+	useTestDB(t)
+	err := addAPIToken("laptop", hashSecret("secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	lastUsed := func() time.Time {
+		tokens, err := getAPITokens()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return tokens[0].LastUsedAt
+	}
+
+	OK, err := useAPIToken(hashSecret("secret"))
+	if err != nil || !OK {
+		t.Fatalf("the token wasn't accepted: %v", err)
+	}
+	first := lastUsed()
+	if first.IsZero() {
+		t.Fatal("the first use wasn't recorded")
+	}
+
+	db, err := getDBConnection()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	// within the resolution the time isn't written again
+	_, err = db.Exec(`UPDATE api_tokens SET last_used_at = ?`, time.Now().Add(-apiTokenUsageResolution/2).Unix())
+	if err != nil {
+		t.Fatal(err)
+	}
+	before := lastUsed()
+	useAPIToken(hashSecret("secret"))
+	if !lastUsed().Equal(before) {
+		t.Error("the last use was written again within the resolution")
+	}
+	_, err = db.Exec(`UPDATE api_tokens SET last_used_at = ?`, time.Now().Add(-2*apiTokenUsageResolution).Unix())
+	if err != nil {
+		t.Fatal(err)
+	}
+	useAPIToken(hashSecret("secret"))
+	if time.Since(lastUsed()) > apiTokenUsageResolution {
+		t.Error("the last use wasn't updated past the resolution")
+	}
+
+	OK, err = useAPIToken(hashSecret("wrong"))
+	if err != nil || OK {
+		t.Errorf("an unknown token was accepted (%v)", err)
+	}
+}
+
+func TestLoginLimiter(t *testing.T) {
+	now := time.Now()
+	l := newLoginLimiter(3, time.Minute)
+	for i := 0; i < 3; i++ {
+		if _, OK := l.begin("a", now); !OK {
+			t.Fatalf("attempt %d of a was refused", i+1)
+		}
+	}
+	wait, OK := l.begin("a", now.Add(10*time.Second))
+	if OK || wait != 50*time.Second {
+		t.Fatalf("the 4th attempt of a got %v, %v, want to wait 50s", OK, wait)
+	}
+	// other clients have their own limit, however many clients are guessing
+	for _, client := range []string{"b", "c", "d"} {
+		for i := 0; i < 3; i++ {
+			if _, OK := l.begin(client, now); !OK {
+				t.Fatalf("attempt %d of %s was refused", i+1, client)
+			}
+		}
+	}
+	// the attempts expire with the window
+	if _, OK := l.begin("a", now.Add(time.Minute)); !OK {
+		t.Fatal("an attempt after the window was refused")
+	}
+	// logging in forgets the attempts of the client only
+	l.succeeded("a")
+	if _, OK := l.begin("a", now.Add(time.Minute)); !OK {
+		t.Fatal("an attempt after logging in was refused")
+	}
+}
+
+func TestLoginLimiterCountsConcurrentAttempts(t *testing.T) {
+	l := newLoginLimiter(5, time.Minute)
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	allowed := 0
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, OK := l.begin("a", time.Now()); OK {
+				mu.Lock()
+				allowed++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	if allowed != 5 {
+		t.Fatalf("%d concurrent attempts were allowed, want 5", allowed)
+	}
+}
+
+func TestLoginHandlerLimitsAttempts(t *testing.T) {
+	useTestDB(t)
+	hash, err := hashPassword("correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = setSetting(passwordSettingKey, hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	loginAttempts = newLoginLimiter(maxClientLoginAttempts, loginAttemptsWindow)
+	t.Cleanup(func() {
+		loginAttempts = newLoginLimiter(maxClientLoginAttempts, loginAttemptsWindow)
+	})
+
+	login := func(client, password string) *httptest.ResponseRecorder {
+		form := url.Values{"password": {password}, "csrf_token": {testCSRFToken}}
+		r := httptest.NewRequest(http.MethodPost, "/login", strings.NewReader(form.Encode()))
+		r.RemoteAddr = client + ":1234"
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		r.AddCookie(&http.Cookie{Name: csrfCookieName, Value: testCSRFToken})
+		return doRequest(routes(ServerConfig{Auth: true}), r)
+	}
+
+	// many guessing clients don't lock the owner out
+	for _, client := range []string{"192.0.2.1", "192.0.2.2", "192.0.2.3", "192.0.2.4", "192.0.2.5", "192.0.2.6", "192.0.2.7"} {
+		for i := 0; i < maxClientLoginAttempts; i++ {
+			if w := login(client, "wrong"); w.Code != http.StatusUnauthorized {
+				t.Fatalf("wrong password %d of %s answered %d, want %d", i+1, client, w.Code, http.StatusUnauthorized)
+			}
+		}
+	}
+	w := login("192.0.2.1", "correct horse")
+	if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") == "" {
+		t.Fatalf("a login over the limit answered %d, want %d with Retry-After", w.Code, http.StatusTooManyRequests)
+	}
+	if w := login("198.51.100.1", "correct horse"); w.Code != http.StatusSeeOther {
+		t.Fatalf("the owner's login answered %d, want %d", w.Code, http.StatusSeeOther)
+	}
+}
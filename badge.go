@@ -0,0 +1,139 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// heatmapTheme colors the heatmap of a badge or of the terminal, Levels holding one color per level
+// returned by getLevel, the same as those of the theme of the web page of the same name
+type heatmapTheme struct {
+	Background string
+	Text       string
+	Levels     []string
+}
+
+var heatmapThemes = map[string]heatmapTheme{
+	"light":         {Background: "#ffffff", Text: "#57606a", Levels: levelColors},
+	"dark":          {Background: "#0d1117", Text: "#8b949e", Levels: []string{"#161b22", "#0e4429", "#006d32", "#26a641", "#39d353", "#6ee77f", "#b4f5bd"}},
+	"high-contrast": {Background: "#000000", Text: "#ffffff", Levels: []string{"#262626", "#5c5c00", "#8a8a00", "#b8b800", "#e6e600", "#ffff66", "#ffffff"}},
+}
+
+// dayColor is the color of a day of the chart, that of the palette of its main activity when one is set
+func (theme heatmapTheme) dayColor(day *DayActivities) string {
+	if day.Color != "" {
+		return day.Color
+	}
+	return theme.Levels[day.Level]
+}
+
+func heatmapThemeNames() string {
+	names := make([]string, 0, len(heatmapThemes))
+	for name := range heatmapThemes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
+// the size of cells is limited so that a badge stays an image one can embed
+const (
+	minBadgeCell     = 4
+	maxBadgeCell     = 32
+	defaultBadgeCell = 10
+)
+
+// parseBadgeCell parses the size of the cells of a badge in pixels, defaulting when empty
+func parseBadgeCell(s string) (int, error) {
+	if s == "" {
+		return defaultBadgeCell, nil
+	}
+	cell, err := strconv.Atoi(s)
+	if err != nil || cell < minBadgeCell || cell > maxBadgeCell {
+		return 0, fmt.Errorf("invalid cell size %q, expected %d to %d pixels", s, minBadgeCell, maxBadgeCell)
+	}
+	return cell, nil
+}
+
+type badgeCell struct {
+	X, Y  int
+	Size  int
+	Color string
+	Title string
+}
+
+type badgeLabel struct {
+	X, Y  int
+	Label string
+}
+
+// BadgeData positions everything drawn on a badge, in pixels
+type BadgeData struct {
+	Title         string
+	Width, Height int
+	FontSize      int
+	Theme         heatmapTheme
+	Cells         []badgeCell
+	MonthLabels   []badgeLabel
+	WeekdayLabels []badgeLabel
+	Legend        []badgeCell
+	LegendLess    badgeLabel
+	LegendMore    badgeLabel
+}
+
+// computeBadgeData lays the chart out like the web page does: a column per week, month labels
+// above the columns, weekday labels on their left and a legend below
+func computeBadgeData(acd *ActivityChartData, theme heatmapTheme, cell int) *BadgeData {
+	gap := max(1, cell/5)
+	step := cell + gap
+	fontSize := max(8, cell)
+	left := fontSize * 3
+	top := fontSize*2 + fontSize + gap
+
+	bd := &BadgeData{
+		Title:    fmt.Sprintf("Activity Tracker for %s", acd.Title),
+		FontSize: fontSize,
+		Theme:    theme,
+	}
+	if len(acd.Activities) > 0 {
+		bd.Title += fmt.Sprintf(" (%s)", strings.Join(acd.Activities, ", "))
+	}
+
+	for column, week := range acd.Weeks {
+		for row, day := range week {
+			if day == nil {
+				continue
+			}
+			bd.Cells = append(bd.Cells, badgeCell{
+				X:     left + column*step,
+				Y:     top + row*step,
+				Size:  cell,
+				Color: theme.dayColor(day),
+				Title: fmt.Sprintf("%s: %.1f hrs", day.Date, day.TotalHours),
+			})
+		}
+	}
+	for _, ml := range acd.MonthLabels {
+		bd.MonthLabels = append(bd.MonthLabels, badgeLabel{X: left + ml.Column*step, Y: top - gap - fontSize/4, Label: ml.Label})
+	}
+	for row, label := range acd.WeekdayLabels {
+		if label != "" {
+			bd.WeekdayLabels = append(bd.WeekdayLabels, badgeLabel{X: 0, Y: top + row*step + cell - max(1, (cell-fontSize*3/4)/2), Label: label})
+		}
+	}
+
+	width := left + len(acd.Weeks)*step
+	legendY := top + 7*step + gap
+	legendX := width - (len(theme.Levels)*step + fontSize*5)
+	bd.LegendLess = badgeLabel{X: legendX, Y: legendY + cell - 1, Label: "Less"}
+	for level, color := range theme.Levels {
+		bd.Legend = append(bd.Legend, badgeCell{X: legendX + fontSize*2 + level*step + gap, Y: legendY, Size: cell, Color: color})
+	}
+	bd.LegendMore = badgeLabel{X: legendX + fontSize*2 + len(theme.Levels)*step + gap*2, Y: legendY + cell - 1, Label: "More"}
+
+	bd.Width = width + gap
+	bd.Height = legendY + cell + gap
+	return bd
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// how often the database is checked for changes made by other processes
+	changesPollInterval = time.Second
+	// how long the recorded changes are kept for servers to read them
+	changesRetention = 24 * time.Hour
+)
+
+// changeWatcher notices the changes made to the sessions and settings by any process, the server
+// included. data_version only changes when another connection commits, so the cheap pragma is
+// polled and the session_changes table only read when it did
+type changeWatcher struct {
+	db          *sql.DB
+	conn        *sql.Conn
+	dataVersion int64
+	lastChange  int64
+}
+
+func newChangeWatcher(ctx context.Context) (*changeWatcher, error) {
+	db, err := getDBConnection()
+	if err != nil {
+		return nil, err
+	}
+	// data_version is per connection, so the same one has to be used for every poll
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	cw := &changeWatcher{db: db, conn: conn}
+
+	err = conn.QueryRowContext(ctx, get_data_version).Scan(&cw.dataVersion)
+	if err == nil {
+		err = conn.QueryRowContext(ctx, get_last_session_change).Scan(&cw.lastChange)
+	}
+	if err == nil {
+		err = cw.prune(ctx)
+	}
+	if err != nil {
+		cw.close()
+		return nil, err
+	}
+	return cw, nil
+}
+
+// prune deletes the changes older than changesRetention, which every server has read by then
+func (cw *changeWatcher) prune(ctx context.Context) error {
+	_, err := cw.conn.ExecContext(ctx, delete_session_changes_before, time.Now().Add(-changesRetention).Unix())
+	return err
+}
+
+func (cw *changeWatcher) close() {
+	cw.conn.Close()
+	cw.db.Close()
+}
+
+// poll returns the dates whose sessions changed since the previous poll, all being set
+// when the settings changed and every chart may be affected
+func (cw *changeWatcher) poll(ctx context.Context) ([]string, bool, error) {
+	var dataVersion int64
+	err := cw.conn.QueryRowContext(ctx, get_data_version).Scan(&dataVersion)
+	if err != nil {
+		return nil, false, err
+	}
+	if dataVersion == cw.dataVersion {
+		return nil, false, nil
+	}
+	// the theme has no trigger recording its changes, it is read again whenever another process wrote
+	err = setCurrentTheme()
+	if err != nil {
+		return nil, false, err
+	}
+
+	rows, err := cw.conn.QueryContext(ctx, get_session_changes_after, cw.lastChange)
+	if err != nil {
+		return nil, false, err
+	}
+	defer rows.Close()
+
+	seen := make(map[string]bool)
+	dates := make([]string, 0)
+	all := false
+	lastChange := cw.lastChange
+	for rows.Next() {
+		var id int64
+		var date sql.NullString
+		err = rows.Scan(&id, &date)
+		if err != nil {
+			return nil, false, err
+		}
+		lastChange = id
+		if !date.Valid {
+			all = true
+			continue
+		}
+		if !seen[date.String] {
+			seen[date.String] = true
+			dates = append(dates, date.String)
+		}
+	}
+	err = rows.Err()
+	if err != nil {
+		return nil, false, err
+	}
+	cw.dataVersion = dataVersion
+	cw.lastChange = lastChange
+	sort.Strings(dates)
+	// other processes wrote to the database, which may have added changes
+	err = cw.prune(ctx)
+	if err != nil {
+		return nil, false, err
+	}
+	return dates, all, nil
+}
+
+// watchChanges drops the cached charts showing the days changed by any process, refreshes the
+// year options and pushes the new totals of those days to the pages subscribed to /events
+func watchChanges(ctx context.Context) {
+	cw, err := newChangeWatcher(ctx)
+	if err != nil {
+		log.Printf("error watching the database for changes: %v", err)
+		return
+	}
+	defer cw.close()
+
+	ticker := time.NewTicker(changesPollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		dates, all, err := cw.poll(ctx)
+		if err != nil {
+			log.Printf("error reading the database changes: %v", err)
+			continue
+		}
+		if len(dates) == 0 && !all {
+			continue
+		}
+		err = invalidateChartData(dates, all)
+		if err != nil {
+			log.Println(err.Error())
+		}
+		sessionEvents.publishDays(dates)
+	}
+}
+
+// invalidateChartData drops the cached charts showing any of dates, or every chart when all is set
+// or the years with sessions changed, since each chart lists the years to choose from
+func invalidateChartData(dates []string, all bool) error {
+	previous := strings.Join(getYearOptions(), ",")
+	err := setYearsOptions()
+	if err != nil {
+		return err
+	}
+	if all || strings.Join(getYearOptions(), ",") != previous {
+		charts.clear()
+		return nil
+	}
+	charts.invalidateDates(dates...)
+	return nil
+}
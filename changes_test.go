@@ -0,0 +1,226 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestChangeWatcher(t *testing.T) *changeWatcher {
+	t.Helper()
+	cw, err := newChangeWatcher(context.Background())
+	if err != nil {
+		t.Fatalf("watching the changes: %v", err)
+	}
+	t.Cleanup(cw.close)
+	return cw
+}
+
+// dayCellOf returns the level class the chart of the last 12 months served by the dashboard gives date
+func dayCellOf(t *testing.T, handler http.Handler, date string) string {
+	t.Helper()
+	w := doRequest(handler, httptest.NewRequest(http.MethodGet, "/summary?year="+ROLLING_YEAR, nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("GET /summary answered %d", w.Code)
+	}
+	body, _ := io.ReadAll(w.Body)
+	marker := fmt.Sprintf(`data-date="%s"`, date)
+	i := strings.Index(string(body), marker)
+	if i < 0 {
+		t.Fatalf("the chart has no cell for %s", date)
+	}
+	cell := string(body[strings.LastIndex(string(body[:i]), "<div"):i])
+	return strings.TrimSpace(cell)
+}
+
+func countSessionChanges(t *testing.T) int {
+	t.Helper()
+	db, err := getDBConnection()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	var n int
+	err = db.QueryRow(`SELECT COUNT(*) FROM session_changes`).Scan(&n)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+func TestCLIChangesReachTheWeb(t *testing.T) {
+	useTestDB(t)
+	handler := routes(ServerConfig{})
+	day := time.Now().AddDate(0, 0, -2).Truncate(24 * time.Hour).Add(8 * time.Hour)
+	otherDay := day.AddDate(0, 0, -1)
+	date, otherDate := day.Format("2006-01-02"), otherDay.Format("2006-01-02")
+	mustAddSession(t, "reading", day, 30)
+
+	// the server caches the chart, then the cli records more sessions from its own connection
+	if cell := dayCellOf(t, handler, date); cell != `<div class="day level-1"` {
+		t.Fatalf("before the cli changes the cell is %s, want level 1", cell)
+	}
+	cw := newTestChangeWatcher(t)
+	mustAddSession(t, "reading", day.Add(time.Hour), 180)
+	mustAddSession(t, "writing", otherDay, 90)
+	if cell := dayCellOf(t, handler, date); cell != `<div class="day level-1"` {
+		t.Fatalf("the chart wasn't cached, the cell is already %s", cell)
+	}
+
+	dates, all, err := cw.poll(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if all || !slices.Equal(dates, []string{otherDate, date}) {
+		t.Fatalf("the changed dates are %v (all: %v), want %v", dates, all, []string{otherDate, date})
+	}
+	err = invalidateChartData(dates, all)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cell := dayCellOf(t, handler, date); cell != `<div class="day level-4"` {
+		t.Errorf("after the cli changes the cell is %s, want level 4", cell)
+	}
+	if cell := dayCellOf(t, handler, otherDate); cell != `<div class="day level-2"` {
+		t.Errorf("the cell of the new day is %s, want level 2", cell)
+	}
+
+	// nothing changed since
+	dates, all, err = cw.poll(context.Background())
+	if err != nil || len(dates) != 0 || all {
+		t.Fatalf("a second poll returned %v (all: %v, err: %v), want nothing", dates, all, err)
+	}
+}
+
+func TestOnlyChartSettingsInvalidateEveryChart(t *testing.T) {
+	useTestDB(t)
+	cw := newTestChangeWatcher(t)
+	cases := []struct {
+		key, value string
+		all        bool
+	}{
+		{SETTING_THEME, "dark", false},
+		{passwordSettingKey, "hash", false},
+		{SETTING_WEEK_START, "monday", true},
+		{SETTING_WEEK_START, "sunday", true},
+		{SETTING_PALETTE_PREFIX + "reading", "#111,#222,#333,#444,#555,#666", true},
+	}
+	for _, c := range cases {
+		err := setSetting(c.key, c.value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		dates, all, err := cw.poll(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if all != c.all || len(dates) != 0 {
+			t.Errorf("setting %s returned the dates %v and all %v, want all %v", c.key, dates, all, c.all)
+		}
+	}
+}
+
+func TestSessionChangesKeepOneRowPerDate(t *testing.T) {
+	useTestDB(t)
+	day := time.Now().AddDate(0, 0, -3).Truncate(24 * time.Hour)
+	// like an import, many sessions on a few days
+	for i := 0; i < 40; i++ {
+		mustAddSession(t, "reading", day.Add(time.Duration(i)*10*time.Minute), 5)
+	}
+	session := mustAddSession(t, "writing", day.AddDate(0, 0, -1), 30)
+	_, err := deleteSession(session.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		setSetting(SETTING_WEEK_START, "monday")
+	}
+	if n := countSessionChanges(t); n != 3 {
+		t.Fatalf("session_changes holds %d rows, want one per date and one for the settings", n)
+	}
+}
+
+func TestChangeWatcherPrunesOldChanges(t *testing.T) {
+	useTestDB(t)
+	mustAddSession(t, "reading", time.Now().Add(-2*time.Hour), 30)
+	cw := newTestChangeWatcher(t)
+
+	db, err := getDBConnection()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	_, err = db.Exec(`UPDATE session_changes SET changed_at = ?`, time.Now().Add(-2*changesRetention).Unix())
+	if err != nil {
+		t.Fatal(err)
+	}
+	mustAddSession(t, "writing", time.Now().AddDate(0, 0, -5), 30)
+
+	_, _, err = cw.poll(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := countSessionChanges(t); n != 1 {
+		t.Fatalf("session_changes holds %d rows after the poll, want only the recent one", n)
+	}
+}
+
+func TestInitializeDBReplacesOutdatedTriggers(t *testing.T) {
+	useTestDB(t)
+	db, err := getDBConnection()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	// the trigger of the first version recorded every setting
+	_, err = db.Exec(`DROP TRIGGER settings_inserted;
+CREATE TRIGGER settings_inserted AFTER INSERT ON settings BEGIN
+    INSERT INTO session_changes(date, changed_at) VALUES (NULL, 0);
+END;
+PRAGMA user_version = 0;`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = initializeDB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = setSetting(SETTING_THEME, "dark")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := countSessionChanges(t); n != 0 {
+		t.Fatalf("changing the theme recorded %d changes, the outdated trigger was kept", n)
+	}
+}
+
+func TestThemeChangesReachTheWeb(t *testing.T) {
+	useTestDB(t)
+	cw := newTestChangeWatcher(t)
+	if !strings.Contains(themeStylesheet(), "themes/light.") {
+		t.Fatalf("the default stylesheet is %s, want the light theme", themeStylesheet())
+	}
+
+	// the cli changes the theme from its own connection, the pages keep the one read until the watcher notices
+	err := setSetting(SETTING_THEME, "high-contrast")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(themeStylesheet(), "themes/light.") {
+		t.Fatalf("the theme was read again before the change was noticed, the stylesheet is %s", themeStylesheet())
+	}
+	_, _, err = cw.poll(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(themeStylesheet(), "themes/high-contrast.") {
+		t.Errorf("after the change the stylesheet is %s, want the high-contrast theme", themeStylesheet())
+	}
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// charts the server keeps computed, the least recently used one is dropped past it
+const maxCachedCharts = 32
+
+// chartCache holds the computed charts by year and activities. Cached charts are never modified,
+// a change to the sessions drops the charts showing the days it affects, so they can be rendered
+// without holding any lock. A chart is computed once however many requests ask for it meanwhile,
+// and without blocking the requests for other charts
+type chartCache struct {
+	mu      sync.RWMutex
+	entries map[chartDataKey]*chartCacheEntry
+	loading map[chartDataKey]*chartLoad
+	// bumped by every invalidation, a chart computed across one isn't cached as it may be stale
+	generation uint64
+	maxEntries int
+}
+
+type chartCacheEntry struct {
+	chartData *ActivityChartData
+	// unix nanoseconds, updated under the read lock
+	lastUsed atomic.Int64
+}
+
+// chartLoad is a chart being computed, the requests waiting for it share its result
+type chartLoad struct {
+	done      chan struct{}
+	chartData *ActivityChartData
+	err       error
+}
+
+var charts = newChartCache(maxCachedCharts)
+
+var errChartLoadPanicked = errors.New("computing the chart panicked")
+
+func newChartCache(maxEntries int) *chartCache {
+	return &chartCache{
+		entries:    make(map[chartDataKey]*chartCacheEntry),
+		loading:    make(map[chartDataKey]*chartLoad),
+		maxEntries: maxEntries,
+	}
+}
+
+// get returns the chart cached under key, computing it with load when it isn't.
+// Errors aren't cached, the next request tries again
+func (c *chartCache) get(key chartDataKey, load func() (*ActivityChartData, error)) (*ActivityChartData, error) {
+	c.mu.RLock()
+	entry, OK := c.entries[key]
+	c.mu.RUnlock()
+	if OK {
+		entry.lastUsed.Store(time.Now().UnixNano())
+		return entry.chartData, nil
+	}
+
+	c.mu.Lock()
+	if entry, OK := c.entries[key]; OK {
+		c.mu.Unlock()
+		entry.lastUsed.Store(time.Now().UnixNano())
+		return entry.chartData, nil
+	}
+	if l, OK := c.loading[key]; OK {
+		c.mu.Unlock()
+		<-l.done
+		return l.chartData, l.err
+	}
+	// replaced by the result of load, the waiters get it when load panics
+	l := &chartLoad{done: make(chan struct{}), err: errChartLoadPanicked}
+	c.loading[key] = l
+	generation := c.generation
+	c.mu.Unlock()
+
+	defer func() {
+		c.mu.Lock()
+		delete(c.loading, key)
+		if l.err == nil && generation == c.generation {
+			c.store(key, l.chartData)
+		}
+		c.mu.Unlock()
+		close(l.done)
+	}()
+	l.chartData, l.err = load()
+
+	return l.chartData, l.err
+}
+
+// store caches a chart, dropping the least recently used one when full. c.mu must be held
+func (c *chartCache) store(key chartDataKey, chartData *ActivityChartData) {
+	if len(c.entries) >= c.maxEntries {
+		var oldestKey chartDataKey
+		oldest := int64(-1)
+		for k, entry := range c.entries {
+			if used := entry.lastUsed.Load(); oldest == -1 || used < oldest {
+				oldestKey, oldest = k, used
+			}
+		}
+		delete(c.entries, oldestKey)
+	}
+	entry := &chartCacheEntry{chartData: chartData}
+	entry.lastUsed.Store(time.Now().UnixNano())
+	c.entries[key] = entry
+}
+
+// invalidateDates drops the charts showing any of dates
+func (c *chartCache) invalidateDates(dates ...string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.generation++
+	for key, entry := range c.entries {
+		for _, date := range dates {
+			if entry.chartData.DayActivities(date) != nil {
+				delete(c.entries, key)
+				break
+			}
+		}
+	}
+}
+
+// clear drops every chart
+func (c *chartCache) clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.generation++
+	c.entries = make(map[chartDataKey]*chartCacheEntry)
+}
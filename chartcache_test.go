@@ -0,0 +1,301 @@
+package main
+
+import (
+	"errors"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// testChart is a chart showing the given dates
+func testChart(dates ...string) *ActivityChartData {
+	days := make(map[string]*DayActivities)
+	for _, date := range dates {
+		days[date] = &DayActivities{Date: date}
+	}
+	return &ActivityChartData{days: days}
+}
+
+// countingLoad returns a load function counting its calls in n
+func countingLoad(n *atomic.Int32, dates ...string) func() (*ActivityChartData, error) {
+	return func() (*ActivityChartData, error) {
+		n.Add(1)
+		return testChart(dates...), nil
+	}
+}
+
+func TestChartCacheLoadsOnce(t *testing.T) {
+	c := newChartCache(4)
+	key := newChartDataKey("2024", nil)
+	var loads atomic.Int32
+	release := make(chan struct{})
+	load := func() (*ActivityChartData, error) {
+		loads.Add(1)
+		<-release
+		return testChart("2024-01-01"), nil
+	}
+
+	var wg sync.WaitGroup
+	results := make([]*ActivityChartData, 50)
+	for i := range results {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			chartData, err := c.get(key, load)
+			if err != nil {
+				t.Error(err)
+			}
+			results[i] = chartData
+		}()
+	}
+	// let the requests pile up on the first load
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if n := loads.Load(); n != 1 {
+		t.Fatalf("the chart was computed %d times, want 1", n)
+	}
+	for i, chartData := range results {
+		if chartData != results[0] {
+			t.Fatalf("request %d got a different chart", i)
+		}
+	}
+	chartData, _ := c.get(key, countingLoad(&loads))
+	if chartData != results[0] || loads.Load() != 1 {
+		t.Fatal("the chart wasn't cached")
+	}
+}
+
+func TestChartCacheDoesntCacheErrors(t *testing.T) {
+	c := newChartCache(4)
+	key := newChartDataKey("2024", nil)
+	_, err := c.get(key, func() (*ActivityChartData, error) { return nil, errors.New("failed") })
+	if err == nil {
+		t.Fatal("the error wasn't returned")
+	}
+	var loads atomic.Int32
+	_, err = c.get(key, countingLoad(&loads))
+	if err != nil || loads.Load() != 1 {
+		t.Fatalf("the chart wasn't computed again after the error: %v", err)
+	}
+}
+
+func TestChartCacheLoadPanicReleasesWaiters(t *testing.T) {
+	c := newChartCache(4)
+	key := newChartDataKey("2024", nil)
+	started := make(chan struct{})
+	release := make(chan struct{})
+
+	go func() {
+		defer func() { recover() }()
+		c.get(key, func() (*ActivityChartData, error) {
+			close(started)
+			<-release
+			panic("boom")
+		})
+	}()
+	<-started
+
+	waited := make(chan error)
+	go func() {
+		_, err := c.get(key, func() (*ActivityChartData, error) { return testChart(), nil })
+		waited <- err
+	}()
+	// the waiter blocks on the panicking load
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+
+	select {
+	case err := <-waited:
+		if !errors.Is(err, errChartLoadPanicked) {
+			t.Fatalf("got %v, want %v", err, errChartLoadPanicked)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("the request waiting for the panicking load hangs")
+	}
+
+	var loads atomic.Int32
+	_, err := c.get(key, countingLoad(&loads))
+	if err != nil || loads.Load() != 1 {
+		t.Fatalf("the chart wasn't computed again after the panic: %v", err)
+	}
+}
+
+func TestChartCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	c := newChartCache(2)
+	var loads atomic.Int32
+	a, b, d := newChartDataKey("2022", nil), newChartDataKey("2023", nil), newChartDataKey("2024", nil)
+
+	c.get(a, countingLoad(&loads))
+	time.Sleep(time.Millisecond)
+	c.get(b, countingLoad(&loads))
+	time.Sleep(time.Millisecond)
+	// a is now used more recently than b
+	c.get(a, countingLoad(&loads))
+	time.Sleep(time.Millisecond)
+	c.get(d, countingLoad(&loads))
+	if n := loads.Load(); n != 3 {
+		t.Fatalf("%d charts were computed, want 3", n)
+	}
+
+	c.get(a, countingLoad(&loads))
+	if n := loads.Load(); n != 3 {
+		t.Fatal("the most recently used chart was evicted")
+	}
+	c.get(b, countingLoad(&loads))
+	if n := loads.Load(); n != 4 {
+		t.Fatal("the least recently used chart wasn't evicted")
+	}
+	if len(c.entries) != 2 {
+		t.Fatalf("the cache holds %d charts, want 2", len(c.entries))
+	}
+}
+
+func TestChartCacheInvalidateDates(t *testing.T) {
+	c := newChartCache(4)
+	var loads atomic.Int32
+	y2023, y2024 := newChartDataKey("2023", nil), newChartDataKey("2024", nil)
+	c.get(y2023, countingLoad(&loads, "2023-06-01"))
+	c.get(y2024, countingLoad(&loads, "2024-06-01"))
+
+	c.invalidateDates("2024-06-01")
+	c.get(y2023, countingLoad(&loads, "2023-06-01"))
+	if n := loads.Load(); n != 2 {
+		t.Fatal("a chart not showing the invalidated date was dropped")
+	}
+	c.get(y2024, countingLoad(&loads, "2024-06-01"))
+	if n := loads.Load(); n != 3 {
+		t.Fatal("the chart showing the invalidated date was kept")
+	}
+
+	c.clear()
+	c.get(y2023, countingLoad(&loads, "2023-06-01"))
+	if n := loads.Load(); n != 4 {
+		t.Fatal("clear kept a chart")
+	}
+}
+
+func TestChartCacheDropsChartsComputedAcrossAnInvalidation(t *testing.T) {
+	c := newChartCache(4)
+	key := newChartDataKey("2024", nil)
+	var loads atomic.Int32
+	c.get(key, func() (*ActivityChartData, error) {
+		loads.Add(1)
+		// a session changes while the chart is being computed
+		c.invalidateDates("2024-06-01")
+		return testChart("2024-06-01"), nil
+	})
+	c.get(key, countingLoad(&loads, "2024-06-01"))
+	if n := loads.Load(); n != 2 {
+		t.Fatal("a chart that may be stale was cached")
+	}
+}
+
+// addBenchmarkSessions records a few sessions a day over years, spread over several activities
+func addBenchmarkSessions(b *testing.B, years int) {
+	b.Helper()
+	db, err := getDBConnection()
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer db.Close()
+	tx, err := db.Begin()
+	if err != nil {
+		b.Fatal(err)
+	}
+	activities := []string{"programming", "reading", "writing", "music", "sport"}
+	r := rand.New(rand.NewSource(1))
+	end := time.Now().UTC().Truncate(24 * time.Hour)
+	for day := end.AddDate(-years, 0, 0); day.Before(end); day = day.AddDate(0, 0, 1) {
+		start := day.Add(8 * time.Hour)
+		for i := r.Intn(4); i > 0; i-- {
+			stop := start.Add(time.Duration(20+r.Intn(120)) * time.Minute)
+			_, err = tx.Exec(insert_session, day.Format("2006-01-02"), activities[r.Intn(len(activities))], start.Unix(), stop.Unix())
+			if err != nil {
+				b.Fatal(err)
+			}
+			start = stop.Add(time.Hour)
+		}
+	}
+	err = tx.Commit()
+	if err != nil {
+		b.Fatal(err)
+	}
+}
+
+// BenchmarkChartCache requests the charts of 5 years of sessions concurrently, by year and
+// activities, as the dashboard does. The uncomputed variant is what every request cost without the cache
+func BenchmarkChartCache(b *testing.B) {
+	useTestDB(b)
+	addBenchmarkSessions(b, 5)
+	err := setYearsOptions()
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	years := append([]string{ROLLING_YEAR}, getYearOptions()...)
+	filters := [][]string{nil, {"reading"}, {"programming", "writing"}}
+	type request struct {
+		year       string
+		activities []string
+	}
+	requests := make([]request, 0, len(years)*len(filters))
+	for _, year := range years {
+		for _, activities := range filters {
+			requests = append(requests, request{year, activities})
+		}
+	}
+
+	b.Run("cached", func(b *testing.B) {
+		charts.clear()
+		var next atomic.Int64
+		b.RunParallel(func(pb *testing.PB) {
+			for pb.Next() {
+				r := requests[int(next.Add(1))%len(requests)]
+				_, err := getChartData(r.year, r.activities)
+				if err != nil {
+					b.Error(err)
+					return
+				}
+			}
+		})
+	})
+
+	b.Run("uncached", func(b *testing.B) {
+		var next atomic.Int64
+		b.RunParallel(func(pb *testing.PB) {
+			for pb.Next() {
+				r := requests[int(next.Add(1))%len(requests)]
+				_, err := computeChartDataForYear(r.year, r.activities)
+				if err != nil {
+					b.Error(err)
+					return
+				}
+			}
+		})
+	})
+
+	// a session being recorded every so often drops the charts showing today
+	b.Run("cached with changes", func(b *testing.B) {
+		charts.clear()
+		var next atomic.Int64
+		today := time.Now().Format("2006-01-02")
+		b.RunParallel(func(pb *testing.PB) {
+			for pb.Next() {
+				n := next.Add(1)
+				if n%100 == 0 {
+					charts.invalidateDates(today)
+				}
+				r := requests[int(n)%len(requests)]
+				_, err := getChartData(r.year, r.activities)
+				if err != nil {
+					b.Error(err)
+					return
+				}
+			}
+		})
+	})
+}
@@ -1,11 +1,19 @@
 package main
 
 import (
+	"bufio"
 	"context"
+	"errors"
 	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
 
 	"github.com/alexeyco/simpletable"
 	"github.com/urfave/cli/v3"
+	"golang.org/x/term"
 )
 
 const DEFAULT_ACTIVITY = "programming"
@@ -88,17 +96,614 @@ func handleTodaysSummary(ctx context.Context, c *cli.Command) error {
 }
 
 func handleSummary(ctx context.Context, c *cli.Command) error {
-	initializeTemplates()
-
-	err := setYearsOptions()
+	err := initializeTemplates()
 	if err != nil {
 		return err
 	}
+	err = setYearsOptions()
+	if err != nil {
+		return err
+	}
+
+	cfg := ServerConfig{
+		Addr:   c.String("addr"),
+		Port:   -1,
+		Socket: c.String("socket"),
+		Open:   c.Bool("open"),
+		Auth:   c.Bool("auth"),
+	}
+	if c.IsSet("port") {
+		cfg.Port = int(c.Int("port"))
+	}
 
 	// run the server
-	err = serve()
+	err = serve(cfg)
 	if err != nil {
 		return fmt.Errorf("error running the server: %v", err)
 	}
 	return nil
 }
+
+func handleBuildSite(ctx context.Context, c *cli.Command) error {
+	err := initializeTemplates()
+	if err != nil {
+		return err
+	}
+
+	out := c.String("out")
+	pages, days, err := buildSite(out)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%d page(s) and the segments of %d day(s) have been written to %s\n", pages, days, out)
+	return nil
+}
+
+func handleTokenCreate(ctx context.Context, c *cli.Command) error {
+	name := strings.TrimSpace(c.String("name"))
+	if name == "" {
+		return fmt.Errorf("the token needs a name, e.g. --name laptop")
+	}
+	token, err := newSecret("gti_")
+	if err != nil {
+		return err
+	}
+	err = addAPIToken(name, hashSecret(token))
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Token %s created, it won't be shown again:\n%s\n", name, token)
+	return nil
+}
+
+func handleTokenList(ctx context.Context, c *cli.Command) error {
+	tokens, err := getAPITokens()
+	if err != nil {
+		return err
+	}
+	if len(tokens) == 0 {
+		fmt.Println("No tokens, create one with: gotimeit token create --name <name>")
+		return nil
+	}
+	table := simpletable.New()
+	table.Header = &simpletable.Header{
+		Cells: []*simpletable.Cell{
+			{Align: simpletable.AlignCenter, Text: "ID"},
+			{Align: simpletable.AlignCenter, Text: "Name"},
+			{Align: simpletable.AlignCenter, Text: "Created"},
+			{Align: simpletable.AlignCenter, Text: "Last used"},
+		},
+	}
+	for _, token := range tokens {
+		lastUsed := "never"
+		if !token.LastUsedAt.IsZero() {
+			lastUsed = token.LastUsedAt.Format("2006-01-02 15:04")
+		}
+		table.Body.Cells = append(table.Body.Cells, []*simpletable.Cell{
+			{Align: simpletable.AlignRight, Text: fmt.Sprintf("%d", token.ID)},
+			{Text: token.Name},
+			{Text: token.CreatedAt.Format("2006-01-02 15:04")},
+			{Text: lastUsed},
+		})
+	}
+	table.SetStyle(simpletable.StyleCompactLite)
+	fmt.Println(table.String())
+	return nil
+}
+
+func handleTokenRevoke(ctx context.Context, c *cli.Command) error {
+	tokens, err := getAPITokens()
+	if err != nil {
+		return err
+	}
+	var token APIToken
+	switch {
+	case c.IsSet("id"):
+		err = fmt.Errorf("no token with id %d", c.Int("id"))
+		for _, t := range tokens {
+			if t.ID == int64(c.Int("id")) {
+				token, err = t, nil
+			}
+		}
+	case c.IsSet("name"):
+		err = fmt.Errorf("no token named %s", c.String("name"))
+		for _, t := range tokens {
+			if t.Name == c.String("name") {
+				token, err = t, nil
+			}
+		}
+	case c.Args().First() != "":
+		token, err = resolveAPIToken(tokens, c.Args().First())
+	default:
+		err = fmt.Errorf("the name or id of the token to revoke is required")
+	}
+	if err != nil {
+		return err
+	}
+	revoked, err := revokeAPIToken(token.ID)
+	if err != nil {
+		return err
+	}
+	if !revoked {
+		return fmt.Errorf("the token %s has already been revoked", token.Name)
+	}
+	fmt.Printf("Token %s (id %d) revoked\n", token.Name, token.ID)
+	return nil
+}
+
+// readPassword reads a line of stdin, without echoing it when stdin is a terminal
+func readPassword(prompt string) (string, error) {
+	if fd := int(os.Stdin.Fd()); term.IsTerminal(fd) {
+		fmt.Print(prompt)
+		password, err := term.ReadPassword(fd)
+		fmt.Println()
+		return string(password), err
+	}
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && !(errors.Is(err, io.EOF) && line != "") {
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+func handlePasswordSet(ctx context.Context, c *cli.Command) error {
+	password, err := readPassword("New password: ")
+	if err != nil {
+		return err
+	}
+	if len(password) < 8 {
+		return fmt.Errorf("the password must be at least 8 characters long")
+	}
+	if isTerminal(os.Stdin) {
+		confirmation, err := readPassword("Repeat the password: ")
+		if err != nil {
+			return err
+		}
+		if confirmation != password {
+			return fmt.Errorf("the passwords don't match")
+		}
+	}
+	hash, err := hashPassword(password)
+	if err != nil {
+		return err
+	}
+	err = setSetting(passwordSettingKey, hash)
+	if err != nil {
+		return err
+	}
+	fmt.Println("Password set, start the server with: gotimeit summary --auth")
+	return nil
+}
+
+func handlePasswordClear(ctx context.Context, c *cli.Command) error {
+	err := setSetting(passwordSettingKey, "")
+	if err != nil {
+		return err
+	}
+	fmt.Println("Password removed, only api tokens can authenticate")
+	return nil
+}
+
+func handleConfigGet(ctx context.Context, c *cli.Command) error {
+	key := c.Args().First()
+	if _, OK := settingDefaults[key]; !OK && !strings.HasPrefix(key, SETTING_PALETTE_PREFIX) {
+		return fmt.Errorf("unknown setting %q", key)
+	}
+	value, err := getSetting(key)
+	if err != nil {
+		return err
+	}
+	fmt.Println(value)
+	return nil
+}
+
+func handleConfigSet(ctx context.Context, c *cli.Command) error {
+	key := c.Args().Get(0)
+	value := strings.TrimSpace(c.Args().Get(1))
+	var err error
+	switch {
+	case key == SETTING_THEME_DIR:
+		// paths are case sensitive, and made absolute so that the server finds them from any directory
+		if value != "" {
+			value, err = filepath.Abs(value)
+			if err != nil {
+				return err
+			}
+		}
+	case strings.HasPrefix(key, SETTING_PALETTE_PREFIX):
+		value = strings.ToLower(strings.ReplaceAll(value, " ", ""))
+	default:
+		value = strings.ToLower(value)
+	}
+	err = validateSetting(key, value)
+	if err != nil {
+		return err
+	}
+	err = setSetting(key, value)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%s is now set to %s\n", key, value)
+	return nil
+}
+
+func handleThemeList(ctx context.Context, c *cli.Command) error {
+	err := loadTheme()
+	if err != nil {
+		return err
+	}
+	themes, err := themeNames(themeFS)
+	if err != nil {
+		return err
+	}
+	current, err := getSetting(SETTING_THEME)
+	if err != nil {
+		return err
+	}
+	for _, theme := range themes {
+		if theme == current {
+			fmt.Printf("* %s\n", theme)
+		} else {
+			fmt.Printf("  %s\n", theme)
+		}
+	}
+	return nil
+}
+
+func handleThemeInit(ctx context.Context, c *cli.Command) error {
+	dir := c.Args().First()
+	if dir == "" {
+		return errors.New("the directory to write the theme to is missing")
+	}
+	written, err := writeThemeDir(dir)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%d files have been written to %s, use them with: gotimeit config set theme_dir %s\n", written, dir, dir)
+	return nil
+}
+
+// shades used for the terminal punch card, from no time tracked to the busiest hour
+var punchCardShades = []string{" ", "░", "▒", "▓", "█"}
+
+func handleStats(ctx context.Context, c *cli.Command) error {
+	from, to, err := parseDateRange(c.String("from"), c.String("to"), 365)
+	if err != nil {
+		return err
+	}
+	stats, err := computeStatistics(from, to, c.StringSlice("activity"))
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Statistics from %s to %s", stats.From, stats.To)
+	if len(stats.Activities) > 0 {
+		fmt.Printf(" for %s", strings.Join(stats.Activities, ", "))
+	}
+	fmt.Println()
+	if stats.SessionCount == 0 {
+		fmt.Println("No sessions found")
+		return nil
+	}
+	fmt.Printf("Sessions: %d, total: %s, average length: %s, median start: %s\n\n",
+		stats.SessionCount, stats.TotalDurationStr, stats.AverageDurationStr, stats.MedianStart)
+
+	// punch card, one row per weekday and one column per hour of the day
+	fmt.Print("     ")
+	for hour := 0; hour < 24; hour += 3 {
+		fmt.Printf("%-6d", hour)
+	}
+	fmt.Println()
+	for row, weekday := range stats.PunchCardWeekdays {
+		fmt.Printf("%s  ", weekday)
+		for _, level := range stats.PunchCardLevels[row] {
+			fmt.Print(strings.Repeat(punchCardShades[level], 2))
+		}
+		fmt.Println()
+	}
+	fmt.Println()
+
+	table := simpletable.New()
+	table.Header = &simpletable.Header{
+		Cells: []*simpletable.Cell{
+			{Align: simpletable.AlignCenter, Text: "LENGTH"},
+			{Align: simpletable.AlignCenter, Text: "SESSIONS"},
+			{Align: simpletable.AlignCenter, Text: "%"},
+		},
+	}
+	for _, bucket := range stats.LengthDistribution {
+		r := []*simpletable.Cell{
+			{Text: bucket.Label},
+			{Align: simpletable.AlignRight, Text: fmt.Sprintf("%d", bucket.Count)},
+			{Align: simpletable.AlignRight, Text: fmt.Sprintf("%d", bucket.Percentage)},
+		}
+		table.Body.Cells = append(table.Body.Cells, r)
+	}
+	table.SetStyle(simpletable.StyleCompactLite)
+	fmt.Println(table.String())
+	fmt.Println()
+
+	table = simpletable.New()
+	table.Header = &simpletable.Header{
+		Cells: []*simpletable.Cell{
+			{Align: simpletable.AlignCenter, Text: "ACTIVITY"},
+			{Align: simpletable.AlignCenter, Text: "LONGEST SESSION"},
+			{Align: simpletable.AlignCenter, Text: "DATE"},
+			{Align: simpletable.AlignCenter, Text: "TIME"},
+		},
+	}
+	for _, longest := range stats.LongestSessions {
+		r := []*simpletable.Cell{
+			{Text: longest.Activity},
+			{Align: simpletable.AlignRight, Text: longest.DurationStr},
+			{Text: longest.Date},
+			{Text: fmt.Sprintf("%s - %s", longest.Start, longest.End)},
+		}
+		table.Body.Cells = append(table.Body.Cells, r)
+	}
+	table.SetStyle(simpletable.StyleCompactLite)
+	fmt.Println(table.String())
+	return nil
+}
+
+func handleCompare(ctx context.Context, c *cli.Command) error {
+	comparison, err := comparePeriods(c.String("period"), time.Now())
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("%s compared to %s\n", comparison.CurrentLabel, comparison.PreviousLabel)
+	table := simpletable.New()
+	table.Header = &simpletable.Header{
+		Cells: []*simpletable.Cell{
+			{Align: simpletable.AlignCenter, Text: "ACTIVITY"},
+			{Align: simpletable.AlignCenter, Text: "PREVIOUS"},
+			{Align: simpletable.AlignCenter, Text: "CURRENT"},
+			{Align: simpletable.AlignCenter, Text: "CHANGE"},
+			{Align: simpletable.AlignCenter, Text: "%"},
+			{Align: simpletable.AlignCenter, Text: "TREND"},
+		},
+	}
+	for _, row := range append(comparison.Rows, comparison.Total) {
+		r := []*simpletable.Cell{
+			{Text: row.Activity},
+			{Align: simpletable.AlignRight, Text: row.PreviousStr},
+			{Align: simpletable.AlignRight, Text: row.CurrentStr},
+			{Align: simpletable.AlignRight, Text: row.ChangeStr},
+			{Align: simpletable.AlignRight, Text: row.ChangePercentage},
+			{Text: row.Sparkline},
+		}
+		table.Body.Cells = append(table.Body.Cells, r)
+	}
+	table.SetStyle(simpletable.StyleCompactLite)
+	fmt.Println(table.String())
+	return nil
+}
+
+func handleReview(ctx context.Context, c *cli.Command) error {
+	err := initializeTemplates()
+	if err != nil {
+		return err
+	}
+
+	year := c.String("year")
+	format := c.String("format")
+	review, err := computeYearReview(year)
+	if err != nil {
+		return err
+	}
+	reviewBytes, err := renderReview(review, format)
+	if err != nil {
+		return err
+	}
+
+	out := c.String("out")
+	if out == "" {
+		out = fmt.Sprintf("gotimeit-review-%s.%s", year, format)
+	}
+	if out == "-" {
+		_, err = os.Stdout.Write(reviewBytes)
+		return err
+	}
+	err = os.WriteFile(out, reviewBytes, 0644)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("The review of %s has been written to %s\n", year, out)
+	return nil
+}
+
+func handleHeatmap(ctx context.Context, c *cli.Command) error {
+	year := c.String("year")
+	if year == "" {
+		year = ROLLING_YEAR
+	}
+	theme, OK := heatmapThemes[c.String("theme")]
+	if !OK {
+		return fmt.Errorf("invalid theme %q, expected one of %s", c.String("theme"), heatmapThemeNames())
+	}
+	chartData, err := computeChartDataForYear(year, c.StringSlice("activity"))
+	if err != nil {
+		return err
+	}
+	fmt.Print(renderTerminalHeatmap(chartData, theme, detectColorMode(c.Bool("no-color"))))
+	return nil
+}
+
+func handleBadge(ctx context.Context, c *cli.Command) error {
+	err := initializeTemplates()
+	if err != nil {
+		return err
+	}
+
+	year := c.String("year")
+	if year == "" {
+		year = ROLLING_YEAR
+	}
+	theme, OK := heatmapThemes[c.String("theme")]
+	if !OK {
+		return fmt.Errorf("invalid theme %q, expected one of %s", c.String("theme"), heatmapThemeNames())
+	}
+	cell, err := parseBadgeCell(c.String("cell"))
+	if err != nil {
+		return err
+	}
+	chartData, err := computeChartDataForYear(year, c.StringSlice("activity"))
+	if err != nil {
+		return err
+	}
+	badgeBytes, err := renderBadge(computeBadgeData(chartData, theme, cell))
+	if err != nil {
+		return err
+	}
+
+	out := c.String("out")
+	if out == "-" {
+		_, err = os.Stdout.Write(badgeBytes)
+		return err
+	}
+	err = os.WriteFile(out, badgeBytes, 0644)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("The heatmap of %s has been written to %s\n", chartData.Title, out)
+	return nil
+}
+
+func handleTimeline(ctx context.Context, c *cli.Command) error {
+	date := c.String("date")
+	if date == "" {
+		date = time.Now().Format("2006-01-02")
+	}
+	_, err := time.Parse("2006-01-02", date)
+	if err != nil {
+		return fmt.Errorf("invalid date %q, expected yyyy-mm-dd", date)
+	}
+	segments, err := getSegmentsFor(date)
+	if err != nil {
+		return err
+	}
+	timeline, err := renderTerminalTimeline(date, segments, detectColorMode(c.Bool("no-color")))
+	if err != nil {
+		return err
+	}
+	fmt.Print(timeline)
+	return nil
+}
+
+func handleExport(ctx context.Context, c *cli.Command) error {
+	// without a range every session is exported
+	from, to := c.String("from"), c.String("to")
+	if from == "" {
+		from = "0001-01-01"
+	}
+	if to == "" {
+		to = "9999-12-31"
+	}
+	from, to, err := parseDateRange(from, to, 0)
+	if err != nil {
+		return err
+	}
+
+	out := c.String("out")
+	if out == "" || out == "-" {
+		return exportSessions(os.Stdout, c.String("format"), from, to, c.StringSlice("activity"), c.Bool("daily"))
+	}
+	f, err := os.Create(out)
+	if err != nil {
+		return err
+	}
+	err = exportSessions(f, c.String("format"), from, to, c.StringSlice("activity"), c.Bool("daily"))
+	if err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func handleImport(ctx context.Context, c *cli.Command) error {
+	filename := c.Args().First()
+	if filename == "" {
+		return fmt.Errorf("the file to import is required")
+	}
+	read, OK := importReaders[c.String("from-format")]
+	if !OK {
+		return fmt.Errorf("unsupported format %q, expected one of %s", c.String("from-format"), importReaderFormats())
+	}
+	columns, err := parseColumnMapping(c.StringSlice("column"))
+	if err != nil {
+		return err
+	}
+	activities, err := loadActivityMapping(c.String("mapping"))
+	if err != nil {
+		return err
+	}
+
+	records, invalid, skipped, err := read(filename, importOptions{ColumnMapping: columns, TimeFormat: c.String("time-format")})
+	if err != nil {
+		return err
+	}
+	records, unresolved := prepareRecords(records, activities)
+	report, err := importSessions(records, append(invalid, unresolved...), c.Bool("dry-run"))
+	if report != nil {
+		report.Skipped = skipped
+		printImportReport(report, c.Bool("dry-run"))
+	}
+	return err
+}
+
+func handleImportICS(ctx context.Context, c *cli.Command) error {
+	filename := c.Args().First()
+	if filename == "" {
+		return fmt.Errorf("the calendar to import is required")
+	}
+	activity := strings.TrimSpace(c.String("activity"))
+	if activity == "" {
+		return fmt.Errorf("the activity can't be empty")
+	}
+	fromStr, toStr, err := parseDateRange(c.String("from"), c.String("to"), 30)
+	if err != nil {
+		return err
+	}
+	from, _ := time.ParseInLocation("2006-01-02", fromStr, time.Local)
+	to, _ := time.ParseInLocation("2006-01-02", toStr, time.Local)
+
+	records, invalid, skipped, err := readICS(filename, activity, from, to)
+	if err != nil {
+		return err
+	}
+	records, unresolved := prepareRecords(records, &activityMapping{})
+	report, err := importSessions(records, append(invalid, unresolved...), c.Bool("dry-run"))
+	if report != nil {
+		report.Skipped = skipped
+		printImportReport(report, c.Bool("dry-run"))
+	}
+	return err
+}
+
+func printImportReport(report *ImportReport, dryRun bool) {
+	for _, message := range report.Invalid {
+		fmt.Printf("invalid   %s\n", message)
+	}
+	for _, message := range report.Skipped {
+		fmt.Printf("skipped   %s\n", message)
+	}
+	if dryRun {
+		for _, record := range report.Added {
+			fmt.Printf("add       %s\n", record)
+		}
+		for _, record := range report.Duplicates {
+			fmt.Printf("duplicate %s\n", record)
+		}
+	}
+	for _, record := range report.Overlaps {
+		fmt.Printf("overlap   %s\n", record)
+	}
+
+	verb := "imported"
+	if dryRun || len(report.Invalid) > 0 {
+		verb = "would be imported"
+	}
+	fmt.Printf("%d session(s) %s, %d duplicate(s) and %d overlapping session(s) skipped, %d invalid row(s), %d ignored entries\n",
+		len(report.Added), verb, len(report.Duplicates), len(report.Overlaps), len(report.Invalid), len(report.Skipped))
+}
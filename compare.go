@@ -0,0 +1,201 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+)
+
+// number of periods shown in the trend sparklines, including the current one
+const trendPeriods = 8
+
+var sparklineTicks = []rune("▁▂▃▄▅▆▇█")
+
+// periods activities can be compared over
+var comparePeriodNames = []string{"week", "month", "year"}
+
+func validatePeriod(period string) error {
+	if !contains(comparePeriodNames, period) {
+		return fmt.Errorf("invalid period %q, expected %s", period, strings.Join(comparePeriodNames, ", "))
+	}
+	return nil
+}
+
+// periodStart returns the first day of the week, month or year containing t
+func periodStart(t time.Time, period string, weekStart time.Weekday) (time.Time, error) {
+	y, m, d := t.Date()
+	switch period {
+	case "week":
+		return startOfWeek(time.Date(y, m, d, 0, 0, 0, 0, time.UTC), weekStart), nil
+	case "month":
+		return time.Date(y, m, 1, 0, 0, 0, 0, time.UTC), nil
+	case "year":
+		return time.Date(y, time.January, 1, 0, 0, 0, 0, time.UTC), nil
+	default:
+		return time.Time{}, validatePeriod(period)
+	}
+}
+
+func periodLabel(start time.Time, period string) string {
+	switch period {
+	case "week":
+		return "week of " + start.Format("Jan 02, 2006")
+	case "month":
+		return start.Format("January 2006")
+	default:
+		return start.Format("2006")
+	}
+}
+
+// comparePeriods compares the time spent on each activity in the period containing now with the
+// period before it, along with the totals of the last trendPeriods periods for the sparklines
+func comparePeriods(period string, now time.Time) (*PeriodComparison, error) {
+	err := validatePeriod(period)
+	if err != nil {
+		return nil, err
+	}
+	weekStart, err := getWeekStart()
+	if err != nil {
+		return nil, err
+	}
+
+	// starts[i] is the first day of the i-th period, the last one being the current period
+	starts := make([]time.Time, trendPeriods)
+	current, err := periodStart(now, period, weekStart)
+	if err != nil {
+		return nil, err
+	}
+	starts[trendPeriods-1] = current
+	for i := trendPeriods - 2; i >= 0; i-- {
+		starts[i], _ = periodStart(starts[i+1].AddDate(0, 0, -1), period, weekStart)
+	}
+	end := nextPeriodStart(current, period).AddDate(0, 0, -1)
+
+	as, err := getTimeSpentOnEachActivityEverydayBetween(starts[0].Format("2006-01-02"), end.Format("2006-01-02"), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	index := make(map[string]int)
+	for i, start := range starts {
+		index[start.Format("2006-01-02")] = i
+	}
+	minutes := make(map[string][]float64)
+	totals := make([]float64, trendPeriods)
+	for _, session := range as {
+		date, err := time.Parse("2006-01-02", session.Date)
+		if err != nil {
+			return nil, err
+		}
+		start, _ := periodStart(date, period, weekStart)
+		i, OK := index[start.Format("2006-01-02")]
+		if !OK {
+			continue
+		}
+		if _, OK := minutes[session.Activity]; !OK {
+			minutes[session.Activity] = make([]float64, trendPeriods)
+		}
+		minutes[session.Activity][i] += float64(session.Duration)
+		totals[i] += float64(session.Duration)
+	}
+
+	comparison := &PeriodComparison{
+		Period:        period,
+		CurrentLabel:  periodLabel(starts[trendPeriods-1], period),
+		PreviousLabel: periodLabel(starts[trendPeriods-2], period),
+		Rows:          make([]ActivityComparison, 0, len(minutes)),
+		Total:         newActivityComparison("total", totals),
+	}
+	for activity, trend := range minutes {
+		// activities without any time in the compared periods only show up in the older trend
+		if trend[trendPeriods-1] == 0 && trend[trendPeriods-2] == 0 {
+			continue
+		}
+		comparison.Rows = append(comparison.Rows, newActivityComparison(activity, trend))
+	}
+	sort.Slice(comparison.Rows, func(i, j int) bool {
+		if comparison.Rows[i].current == comparison.Rows[j].current {
+			return comparison.Rows[i].Activity < comparison.Rows[j].Activity
+		}
+		return comparison.Rows[i].current > comparison.Rows[j].current
+	})
+	return comparison, nil
+}
+
+func nextPeriodStart(start time.Time, period string) time.Time {
+	switch period {
+	case "week":
+		return start.AddDate(0, 0, 7)
+	case "month":
+		return start.AddDate(0, 1, 0)
+	default:
+		return start.AddDate(1, 0, 0)
+	}
+}
+
+// newActivityComparison builds a row from the minutes spent in each trend period, oldest first
+func newActivityComparison(activity string, trend []float64) ActivityComparison {
+	current, previous := trend[len(trend)-1], trend[len(trend)-2]
+	change := current - previous
+
+	ac := ActivityComparison{
+		Activity:        activity,
+		CurrentStr:      formatDuration(time.Duration(current * float64(time.Minute))),
+		PreviousStr:     formatDuration(time.Duration(previous * float64(time.Minute))),
+		ChangeStr:       "+" + formatDuration(time.Duration(change*float64(time.Minute))),
+		Sparkline:       sparkline(trend),
+		SparklinePoints: sparklinePoints(trend, 120, 24),
+		Increased:       change > 0,
+		Decreased:       change < 0,
+		current:         current,
+	}
+	if change < 0 {
+		ac.ChangeStr = "-" + formatDuration(time.Duration(-change*float64(time.Minute)))
+	}
+	switch {
+	case previous > 0:
+		ac.ChangePercentage = fmt.Sprintf("%+.0f%%", change*100/previous)
+	case current > 0:
+		ac.ChangePercentage = "new"
+	default:
+		ac.ChangePercentage = "-"
+	}
+	return ac
+}
+
+// sparkline renders values as a line of block characters scaled to the largest value
+func sparkline(values []float64) string {
+	var largest float64
+	for _, v := range values {
+		largest = math.Max(largest, v)
+	}
+	var sb strings.Builder
+	for _, v := range values {
+		tick := 0
+		if largest > 0 {
+			tick = int(v / largest * float64(len(sparklineTicks)-1))
+		}
+		sb.WriteRune(sparklineTicks[tick])
+	}
+	return sb.String()
+}
+
+// sparklinePoints returns the points of an SVG polyline drawing values in a width x height box
+func sparklinePoints(values []float64, width, height int) string {
+	var largest float64
+	for _, v := range values {
+		largest = math.Max(largest, v)
+	}
+	points := make([]string, len(values))
+	for i, v := range values {
+		x := float64(i) * float64(width) / float64(max(len(values)-1, 1))
+		y := float64(height)
+		if largest > 0 {
+			y -= v / largest * float64(height)
+		}
+		points[i] = fmt.Sprintf("%.1f,%.1f", x, y)
+	}
+	return strings.Join(points, " ")
+}
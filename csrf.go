@@ -0,0 +1,117 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"mime"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// Requests changing state are protected against cross-site request forgery with a double-submit token:
+// homeHandler sets the token in a cookie and in the page, from where htmx sends it back in the X-CSRF-Token
+// header. A forged request can't read the page, so it can't send a header matching the cookie.
+// Requests authenticated with an api token need no protection, browsers never send those by themselves
+const (
+	csrfCookieName = "gotimeit_csrf"
+	csrfHeaderName = "X-CSRF-Token"
+)
+
+// csrfToken returns the token of the browser's cookie, setting a new one when there is none
+func csrfToken(w http.ResponseWriter, r *http.Request) (string, error) {
+	if cookie, err := r.Cookie(csrfCookieName); err == nil && len(cookie.Value) == 43 {
+		return cookie.Value, nil
+	}
+	b := make([]byte, 32)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+	token := base64.RawURLEncoding.EncodeToString(b)
+	http.SetCookie(w, &http.Cookie{
+		Name:     csrfCookieName,
+		Value:    token,
+		Path:     "/",
+		HttpOnly: true,
+		SameSite: http.SameSiteStrictMode,
+	})
+	return token, nil
+}
+
+func isSafeMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+		return true
+	}
+	return false
+}
+
+// csrfProtect rejects requests changing state without a valid token. Requests to the json api must
+// send json instead: browsers won't send that cross-site without a CORS preflight, which the server
+// never grants
+func csrfProtect(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if isSafeMethod(r.Method) || isBearerAuthenticated(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if strings.HasPrefix(r.URL.Path, "/api/") {
+			// DELETE can't be sent cross-site without a preflight either, so it needs no body
+			mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+			if r.Method != http.MethodDelete && mediaType != "application/json" {
+				errorResponse(w, r, http.StatusUnsupportedMediaType, "the body must be json, sent with the Content-Type application/json")
+				return
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		cookie, err := r.Cookie(csrfCookieName)
+		token := r.Header.Get(csrfHeaderName)
+		if token == "" {
+			// plain html forms, like the login page, send it as a field
+			token = r.PostFormValue("csrf_token")
+		}
+		if err != nil || token == "" || subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(token)) != 1 {
+			http.Error(w, "Forbidden: missing or invalid CSRF token, reload the page", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// hostProtect rejects the requests for other hosts than the loopback interface, ip addresses and
+// listenHost. DNS rebinding lets a page of another site send requests to a server of this machine with
+// the name of that site as Host, which is the only thing telling them apart when no authentication is required
+func hostProtect(listenHost string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !allowedHost(r.Host, listenHost) {
+				http.Error(w, "Forbidden: unknown host "+r.Host+", open the dashboard on localhost or run summary with --auth", http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func allowedHost(host, listenHost string) bool {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	host = strings.TrimSuffix(strings.ToLower(strings.Trim(host, "[]")), ".")
+	if host == "" {
+		return false
+	}
+	// rebinding needs a name to rebind
+	if net.ParseIP(host) != nil {
+		return true
+	}
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return true
+	}
+	return strings.EqualFold(host, listenHost)
+}
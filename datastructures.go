@@ -6,6 +6,18 @@ const ErrStartSession = "a session is already in progress. Please end the curren
 
 var ErrEndSession = "no current session in progress"
 
+// names of the settings stored in the settings table
+const (
+	SETTING_WEEK_START = "week_start"
+	SETTING_THEME      = "theme"
+	SETTING_THEME_DIR  = "theme_dir"
+	// followed by the name of an activity, e.g. palette.reading
+	SETTING_PALETTE_PREFIX = "palette."
+)
+
+// year option selecting the 365 days ending today instead of a calendar year
+const ROLLING_YEAR = "last12months"
+
 // type ActivitySession struct {
 // 	Date     string
 // 	Activity string
@@ -22,6 +34,7 @@ type ActivitySession struct {
 type SessionDuration struct {
 	DurationPercentage int
 	DurationStr        string
+	Minutes            float32
 }
 
 type DayActivities struct {
@@ -29,23 +42,187 @@ type DayActivities struct {
 	Activities map[string]SessionDuration
 	TotalHours float32
 	Level      int
+	// color of the cell from the palette of the activity most time was spent on, empty for the theme's
+	Color string
+}
+
+type MonthLabel struct {
+	Label string
+	// index of the week column in which the month starts
+	Column int
 }
 
 type ActivityChartData struct {
-	// stores info for the entire year's (52/53 week) activities grouped by months
-	MonthDailyActivities map[time.Month]struct {
-		Offset int
-		DA     []*DayActivities
-	}
-	// for rendering the heading for the chart
+	// stores info for every day between From and To (inclusive) as week columns of 7 days
+	// starting on WeekStart, days of the first and last week outside the window are nil
+	Weeks         [][]*DayActivities
+	MonthLabels   []MonthLabel
+	WeekdayLabels []string
+	WeekStart     string
+	From          string
+	To            string
+	// the selected year option, either a calendar year or ROLLING_YEAR, which templates read as RollingYear
 	Year        string
+	RollingYear string
+	// for rendering the heading for the chart
+	Title       string
 	YearOptions []string
+	// activities the chart is filtered by, empty when every activity is included
+	Activities      []string
+	ActivityOptions []string
+	// set for the pages of a static site, which link to the other years instead of querying the server
+	ReadOnly bool
+	// index of the days above by their date
+	days map[string]*DayActivities
+}
+
+// DayActivities returns the chart's entry for date, or nil when the date is outside the chart
+func (acd *ActivityChartData) DayActivities(date string) *DayActivities {
+	return acd.days[date]
+}
+
+// identifies a cached chart by its year and the activities it is filtered by
+type chartDataKey struct {
+	Year       string
+	Activities string
 }
 
 type TemplateData struct {
 	// activity in current active session
 	ActiveSession                string
 	CurrentYearActivityChartData *ActivityChartData
+	// set for the pages of a static site, which have no session controls and read segments from json files
+	ReadOnly bool
+	// sent back by htmx with every request changing state
+	CSRFToken string
+	// shows the log out button
+	AuthRequired bool
+}
+
+type Session struct {
+	ID       int64
+	Date     string
+	Activity string
+	Start    time.Time
+	// zero while the session is active
+	End time.Time
+}
+
+func (s Session) Duration() time.Duration {
+	return s.End.Sub(s.Start)
+}
+
+type LengthBucket struct {
+	Label      string
+	Count      int
+	Percentage int
+}
+
+type LongestSession struct {
+	Activity    string
+	Date        string
+	Start       string
+	End         string
+	DurationStr string
+	duration    time.Duration
+}
+
+type Statistics struct {
+	From            string
+	To              string
+	Activities      []string
+	ActivityOptions []string
+
+	SessionCount       int
+	TotalDurationStr   string
+	AverageDurationStr string
+	// median time of day at which sessions start, formatted as HH:MM
+	MedianStart string
+
+	// minutes tracked per weekday (rows starting at the configured week start) and hour of day
+	PunchCard         [7][24]float64
+	PunchCardLevels   [7][24]int
+	PunchCardWeekdays []string
+
+	LengthDistribution []LengthBucket
+	// the longest session of every activity, longest first
+	LongestSessions []LongestSession
+}
+
+type ActivityComparison struct {
+	Activity         string
+	CurrentStr       string
+	PreviousStr      string
+	ChangeStr        string
+	ChangePercentage string
+	Increased        bool
+	Decreased        bool
+	// totals of the last periods, oldest first, as block characters and as SVG polyline points
+	Sparkline       string
+	SparklinePoints string
+	current         float64
+}
+
+type PeriodComparison struct {
+	// week, month or year
+	Period        string
+	CurrentLabel  string
+	PreviousLabel string
+	Rows          []ActivityComparison
+	Total         ActivityComparison
+}
+
+type ReviewActivity struct {
+	Activity    string `json:"activity"`
+	DurationStr string `json:"duration"`
+	Minutes     int    `json:"minutes"`
+	// share of the year's total time
+	Percentage int `json:"percentage"`
+}
+
+type ReviewPeriod struct {
+	Label       string `json:"label"`
+	DurationStr string `json:"duration"`
+	Minutes     int    `json:"minutes"`
+}
+
+type ReviewStreak struct {
+	Days int    `json:"days"`
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+type ReviewSession struct {
+	Activity    string `json:"activity"`
+	Date        string `json:"date"`
+	Start       string `json:"start"`
+	DurationStr string `json:"duration"`
+	Minutes     int    `json:"minutes"`
+}
+
+type ReviewMonth struct {
+	Label       string `json:"month"`
+	DurationStr string `json:"duration"`
+	Minutes     int    `json:"minutes"`
+	// relative to the busiest month, for drawing the month by month chart
+	Percentage int `json:"percentage"`
+}
+
+type YearReview struct {
+	Year               string           `json:"year"`
+	TotalDurationStr   string           `json:"total"`
+	TotalMinutes       int              `json:"total_minutes"`
+	SessionCount       int              `json:"sessions"`
+	ActiveDays         int              `json:"active_days"`
+	TopActivities      []ReviewActivity `json:"top_activities"`
+	LongestStreak      *ReviewStreak    `json:"longest_streak"`
+	BusiestDay         *ReviewPeriod    `json:"busiest_day"`
+	BusiestWeek        *ReviewPeriod    `json:"busiest_week"`
+	BusiestMonth       *ReviewPeriod    `json:"busiest_month"`
+	MostProductiveHour *ReviewPeriod    `json:"most_productive_hour"`
+	FirstSession       *ReviewSession   `json:"first_session"`
+	LastSession        *ReviewSession   `json:"last_session"`
+	Months             []ReviewMonth    `json:"months"`
 }
 
 type Segment struct {
@@ -53,3 +230,103 @@ type Segment struct {
 	Start    int64  `json:"start"`
 	End      int64  `json:"end"`
 }
+
+// SessionResponse is a session as returned by the json api, End is null while the session is active
+type SessionResponse struct {
+	ID       int64   `json:"id"`
+	Date     string  `json:"date"`
+	Activity string  `json:"activity"`
+	Start    string  `json:"start"`
+	End      *string `json:"end"`
+	Minutes  float64 `json:"minutes"`
+	Active   bool    `json:"active"`
+}
+
+type ActivityMinutes struct {
+	Activity string  `json:"activity"`
+	Minutes  float64 `json:"minutes"`
+}
+
+type MonthMinutes struct {
+	Month   string  `json:"month"`
+	Minutes float64 `json:"minutes"`
+}
+
+type DailyReport struct {
+	Date         string            `json:"date"`
+	Activities   []ActivityMinutes `json:"activities"`
+	TotalMinutes float64           `json:"total_minutes"`
+}
+
+type YearlyReport struct {
+	Year         string            `json:"year"`
+	Activities   []ActivityMinutes `json:"activities"`
+	Months       []MonthMinutes    `json:"months"`
+	TotalMinutes float64           `json:"total_minutes"`
+}
+
+type HeatmapDay struct {
+	Date       string             `json:"date"`
+	Level      int                `json:"level"`
+	TotalHours float64            `json:"total_hours"`
+	Activities map[string]float64 `json:"activities"`
+}
+
+// HeatmapResponse is the chart of a year as returned by the json api, days being listed in order
+type HeatmapResponse struct {
+	Year       string       `json:"year"`
+	Title      string       `json:"title"`
+	From       string       `json:"from"`
+	To         string       `json:"to"`
+	WeekStart  string       `json:"week_start"`
+	Activities []string     `json:"activities"`
+	Days       []HeatmapDay `json:"days"`
+}
+
+// ServerConfig is where the summary server listens
+type ServerConfig struct {
+	// tcp address, e.g. 127.0.0.1:4000
+	Addr string
+	// replaces the port of Addr when not negative, 0 picking a free port
+	Port int
+	// path of a Unix socket to listen on instead of Addr
+	Socket string
+	// opens the dashboard in the browser once the server listens
+	Open bool
+	// requires a password or an api token for every request
+	Auth bool
+}
+
+// APIToken is a token of the json api, only its hash is stored
+type APIToken struct {
+	ID         int64
+	Name       string
+	CreatedAt  time.Time
+	LastUsedAt time.Time
+}
+
+type LoginData struct {
+	Next      string
+	Error     string
+	CSRFToken string
+}
+
+// SessionEvent is the data of an event pushed to the pages subscribed to /events
+type SessionEvent struct {
+	// the session the event is about, null when it was deleted or the days changed otherwise, e.g. by an import
+	Session *SessionResponse `json:"session"`
+	// seconds since the active session started
+	Elapsed int64 `json:"elapsed,omitempty"`
+	// the session action card matching the new state, empty when it didn't change
+	Card string `json:"card,omitempty"`
+	// the heatmap cells of the days whose totals changed
+	Days []DayCell `json:"days,omitempty"`
+}
+
+// DayCell is a day of the heatmap as the home page draws it
+type DayCell struct {
+	Date    string `json:"date"`
+	Level   int    `json:"level"`
+	Tooltip string `json:"tooltip"`
+	Color   string `json:"color,omitempty"`
+}
@@ -4,6 +4,7 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"strings"
 	"time"
 
 	_ "github.com/mattn/go-sqlite3"
@@ -24,26 +25,168 @@ const create_activitysessions_table = `CREATE TABLE IF NOT EXISTS activitysessio
 	stop_time TIMESTAMP
 );`
 
+const create_settings_table = `CREATE TABLE IF NOT EXISTS settings (
+    key TEXT PRIMARY KEY,
+    value TEXT NOT NULL
+);`
+
+// calendar events imported as sessions, an occurrence of a recurring event being identified by its original start
+const create_imported_events_table = `CREATE TABLE IF NOT EXISTS imported_events (
+    uid TEXT NOT NULL,
+    occurrence INTEGER NOT NULL,
+    session_id INTEGER NOT NULL,
+    PRIMARY KEY (uid, occurrence)
+);`
+
+// tokens of the json api and login sessions of the dashboard, both only stored as sha256 hashes
+const create_api_tokens_table = `CREATE TABLE IF NOT EXISTS api_tokens (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    name TEXT NOT NULL UNIQUE,
+    hash TEXT NOT NULL UNIQUE,
+    created_at INTEGER NOT NULL,
+    last_used_at INTEGER
+);`
+
+const create_login_sessions_table = `CREATE TABLE IF NOT EXISTS login_sessions (
+    hash TEXT PRIMARY KEY,
+    expires_at INTEGER NOT NULL
+);`
+
+// every change to the sessions records the dates it affects, and every change to the settings the charts
+// depend on a null date as it may affect every chart, so that the summary server notices the changes made
+// by other processes, e.g. the cli, and knows which cached charts to drop. A date only keeps its latest
+// change, so the table holds at most a row per day even when no server prunes it
+const create_session_changes_table = `CREATE TABLE IF NOT EXISTS session_changes (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    date TEXT,
+    changed_at INTEGER NOT NULL
+);`
+
+// the triggers of databases whose user_version is older are replaced on startup, bumped along
+// with the user_version set by create_session_changes_triggers
+const session_changes_triggers_version = 1
+
+const create_session_changes_triggers = `
+BEGIN IMMEDIATE;
+CREATE INDEX IF NOT EXISTS session_changes_date ON session_changes(date);
+DROP TRIGGER IF EXISTS activitysessions_inserted;
+DROP TRIGGER IF EXISTS activitysessions_updated;
+DROP TRIGGER IF EXISTS activitysessions_deleted;
+DROP TRIGGER IF EXISTS settings_inserted;
+DROP TRIGGER IF EXISTS settings_updated;
+CREATE TRIGGER activitysessions_inserted AFTER INSERT ON activitysessions BEGIN
+    DELETE FROM session_changes WHERE date = NEW.date;
+    INSERT INTO session_changes(date, changed_at) VALUES (NEW.date, CAST(strftime('%s', 'now') AS INTEGER));
+END;
+CREATE TRIGGER activitysessions_updated AFTER UPDATE ON activitysessions BEGIN
+    DELETE FROM session_changes WHERE date IN (OLD.date, NEW.date);
+    INSERT INTO session_changes(date, changed_at) VALUES (OLD.date, CAST(strftime('%s', 'now') AS INTEGER));
+    INSERT INTO session_changes(date, changed_at) SELECT NEW.date, CAST(strftime('%s', 'now') AS INTEGER) WHERE NEW.date != OLD.date;
+END;
+CREATE TRIGGER activitysessions_deleted AFTER DELETE ON activitysessions BEGIN
+    DELETE FROM session_changes WHERE date = OLD.date;
+    INSERT INTO session_changes(date, changed_at) VALUES (OLD.date, CAST(strftime('%s', 'now') AS INTEGER));
+END;
+CREATE TRIGGER settings_inserted AFTER INSERT ON settings WHEN NEW.key = 'week_start' OR NEW.key LIKE 'palette.%' BEGIN
+    DELETE FROM session_changes WHERE date IS NULL;
+    INSERT INTO session_changes(date, changed_at) VALUES (NULL, CAST(strftime('%s', 'now') AS INTEGER));
+END;
+CREATE TRIGGER settings_updated AFTER UPDATE ON settings WHEN NEW.key = 'week_start' OR NEW.key LIKE 'palette.%' BEGIN
+    DELETE FROM session_changes WHERE date IS NULL;
+    INSERT INTO session_changes(date, changed_at) VALUES (NULL, CAST(strftime('%s', 'now') AS INTEGER));
+END;
+PRAGMA user_version = 1;
+COMMIT;`
+
+const get_user_version = `PRAGMA user_version`
+const get_data_version = `PRAGMA data_version`
+const get_last_session_change = `SELECT COALESCE(MAX(id), 0) FROM session_changes`
+const get_session_changes_after = `SELECT id, date FROM session_changes WHERE id > ? ORDER BY id`
+const delete_session_changes_before = `DELETE FROM session_changes WHERE changed_at < ?`
+
+const insert_api_token = `INSERT INTO api_tokens(name, hash, created_at) VALUES (?, ?, ?)`
+const get_api_tokens = `SELECT id, name, created_at, last_used_at FROM api_tokens ORDER BY id`
+const delete_api_token = `DELETE FROM api_tokens WHERE id = ?`
+const get_api_token_by_hash = `SELECT id, last_used_at FROM api_tokens WHERE hash = ?`
+const use_api_token = `UPDATE api_tokens SET last_used_at = ? WHERE id = ?`
+
+const insert_login_session = `INSERT INTO login_sessions(hash, expires_at) VALUES (?, ?)`
+const count_login_sessions = `SELECT COUNT(*) FROM login_sessions WHERE hash = ? AND expires_at > ?`
+const delete_login_session = `DELETE FROM login_sessions WHERE hash = ? OR expires_at <= ?`
+
+const get_setting = `SELECT value FROM settings WHERE key = ?`
+const get_palettes = `SELECT key, value FROM settings WHERE key LIKE 'palette.%' AND value != ''`
+const set_setting = `INSERT INTO settings(key, value) VALUES (?, ?) ON CONFLICT(key) DO UPDATE SET value = excluded.value`
+
+// values used for settings that were never set
+var settingDefaults = map[string]string{
+	SETTING_WEEK_START: "sunday",
+	SETTING_THEME:      "light",
+	SETTING_THEME_DIR:  "",
+}
+
 const get_activity_sessions_for_today = `
 	SELECT activity, SUM(stop_time-start_time)*1.0/60 as minutes 
 	FROM activitysessions 
 	WHERE date = ? AND stop_time is NOT NULL 
 	GROUP BY activity;`
 
-const get_activity_sessions_everyday_for_year = `
+// the %s verb is replaced with the optional activity filter built by activityFilterClause
+const get_activity_sessions_everyday_between = `
 	SELECT date, activity, SUM(stop_time-start_time)*1.0/60 as minutes 
 	FROM activitysessions 
-	WHERE strftime('%Y', date) = ? AND stop_time is NOT NULL
+	WHERE date BETWEEN ? AND ? AND stop_time is NOT NULL%s
 	GROUP BY date, activity
 	ORDER BY date;`
 
+const get_activities = `SELECT DISTINCT activity FROM activitysessions ORDER BY activity;`
+
+// imported sessions can be older than the ones recorded before, so the years come from the dates rather than the ids
 const get_oldest_and_latest_years = `
 	SELECT 
-    (SELECT strftime('%Y', date) FROM activitysessions ORDER BY id ASC  LIMIT 1) AS oldest_year,
-    (SELECT strftime('%Y', date) FROM activitysessions ORDER BY id DESC LIMIT 1) AS latest_year;`
+    (SELECT strftime('%Y', MIN(date)) FROM activitysessions) AS oldest_year,
+    (SELECT strftime('%Y', MAX(date)) FROM activitysessions) AS latest_year;`
+
+// the %s verb is replaced with the optional activity filter built by activityFilterClause
+const get_sessions_between = `
+	SELECT id, date, activity, start_time, stop_time
+	FROM activitysessions
+	WHERE date BETWEEN ? AND ? AND stop_time IS NOT NULL%s
+	ORDER BY start_time;`
+
+const insert_session = `INSERT INTO activitysessions(date, activity, start_time, stop_time) VALUES (?, ?, ?, ?)`
+
+const count_duplicate_sessions = `SELECT COUNT(*) FROM activitysessions WHERE activity = ? AND start_time = ? AND stop_time = ?`
+
+// a session overlaps [start, end) when it starts before end and ends after start, an active session never ends
+const count_overlapping_sessions = `
+	SELECT COUNT(*) FROM activitysessions
+	WHERE start_time < ? AND (stop_time IS NULL OR stop_time > ?)`
+
+// the same overlap, leaving out the session being edited
+const count_overlapping_sessions_except = count_overlapping_sessions + ` AND id != ?`
+
+const get_session = `SELECT id, date, activity, start_time, stop_time FROM activitysessions WHERE id = ?`
+
+const get_active_session = `SELECT id, date, activity, start_time, stop_time FROM activitysessions WHERE stop_time IS NULL LIMIT 1`
+
+const end_active_session = `UPDATE activitysessions SET stop_time = ? WHERE stop_time IS NULL RETURNING id`
+
+const update_session = `UPDATE activitysessions SET date = ?, activity = ?, start_time = ?, stop_time = ? WHERE id = ?`
+
+const delete_session = `DELETE FROM activitysessions WHERE id = ?`
+
+const count_imported_events = `SELECT COUNT(*) FROM imported_events WHERE uid = ? AND occurrence = ?`
+
+const insert_imported_event = `INSERT INTO imported_events(uid, occurrence, session_id) VALUES (?, ?, ?)`
 
 const get_segments_for_date = `SELECT activity, start_time, stop_time FROM activitysessions WHERE stop_time IS NOT NULL AND date = ?;`
 
+var (
+	ErrSessionNotFound = errors.New("the session doesn't exist")
+	ErrSessionOverlaps = errors.New("the session overlaps another session")
+)
+
 func getDBConnection() (*sql.DB, error) {
 	db, err := sql.Open("sqlite3", DSN)
 	if err != nil {
@@ -79,7 +222,43 @@ func initializeDB() error {
 	defer db.Close()
 
 	_, err = db.Exec(create_activitysessions_table)
+	if err != nil {
+		return err
+	}
 
+	_, err = db.Exec(create_settings_table)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec(create_imported_events_table)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec(create_api_tokens_table)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec(create_login_sessions_table)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec(create_session_changes_table)
+	if err != nil {
+		return err
+	}
+
+	var userVersion int
+	err = db.QueryRow(get_user_version).Scan(&userVersion)
+	if err != nil {
+		return err
+	}
+	if userVersion < session_changes_triggers_version {
+		_, err = db.Exec(create_session_changes_triggers)
+	}
 	return err
 }
 
@@ -223,18 +402,36 @@ func getTimeSpentOnEachActivityFor(date string) ([]ActivitySession, error) {
 	return sessions, nil
 }
 
-func getTimeSpentOnEachActivityEverydayForYear(year string) ([]ActivitySession, error) {
+// activityFilterClause returns an "AND activity IN (...)" clause along with its arguments,
+// or an empty clause when no activities are given
+func activityFilterClause(activities []string) (string, []any) {
+	if len(activities) == 0 {
+		return "", nil
+	}
+	placeholders := make([]string, len(activities))
+	args := make([]any, len(activities))
+	for i, activity := range activities {
+		placeholders[i] = "?"
+		args[i] = activity
+	}
+	return fmt.Sprintf(" AND activity IN (%s)", strings.Join(placeholders, ", ")), args
+}
+
+// forEachDailyTotalBetween calls fn with the time spent on each activity every day between from and to
+// (inclusive) in date order, without loading them all into memory
+func forEachDailyTotalBetween(from, to string, activities []string, fn func(ActivitySession) error) error {
 	db, err := getDBConnection()
 	if err != nil {
-		return nil, err
+		return err
 	}
 	defer db.Close()
-	rows, err := db.Query(get_activity_sessions_everyday_for_year, year)
+	filter, filterArgs := activityFilterClause(activities)
+	args := append([]any{from, to}, filterArgs...)
+	rows, err := db.Query(fmt.Sprintf(get_activity_sessions_everyday_between, filter), args...)
 	if err != nil {
-		return nil, err
+		return err
 	}
 	defer rows.Close()
-	sessions := make([]ActivitySession, 0)
 
 	for rows.Next() {
 		var activitySession ActivitySession
@@ -245,7 +442,7 @@ func getTimeSpentOnEachActivityEverydayForYear(year string) ([]ActivitySession,
 			&activitySession.Duration,
 		)
 		if err != nil {
-			return nil, err
+			return err
 		}
 		hours = int(activitySession.Duration / 60)
 		minutes = int(activitySession.Duration) % 60
@@ -254,11 +451,106 @@ func getTimeSpentOnEachActivityEverydayForYear(year string) ([]ActivitySession,
 		} else {
 			activitySession.DurationStr = fmt.Sprintf("%d hr(s)", hours)
 		}
+		err = fn(activitySession)
+		if err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+func getTimeSpentOnEachActivityEverydayBetween(from, to string, activities []string) ([]ActivitySession, error) {
+	sessions := make([]ActivitySession, 0)
+	err := forEachDailyTotalBetween(from, to, activities, func(activitySession ActivitySession) error {
 		sessions = append(sessions, activitySession)
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
 	return sessions, nil
 }
 
+func getSetting(key string) (string, error) {
+	db, err := getDBConnection()
+	if err != nil {
+		return "", err
+	}
+	defer db.Close()
+
+	var value string
+	err = db.QueryRow(get_setting, key).Scan(&value)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return settingDefaults[key], nil
+		}
+		return "", err
+	}
+	return value, nil
+}
+
+func setSetting(key, value string) error {
+	db, err := getDBConnection()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	_, err = db.Exec(set_setting, key, value)
+	return err
+}
+
+// getPalettes returns the heatmap colors set for activities with config set palette.<activity>
+func getPalettes() (map[string][]string, error) {
+	db, err := getDBConnection()
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	rows, err := db.Query(get_palettes)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	palettes := make(map[string][]string)
+	for rows.Next() {
+		var key, value string
+		err = rows.Scan(&key, &value)
+		if err != nil {
+			return nil, err
+		}
+		palettes[strings.TrimPrefix(key, SETTING_PALETTE_PREFIX)] = strings.Split(value, ",")
+	}
+	return palettes, rows.Err()
+}
+
+func getActivities() ([]string, error) {
+	db, err := getDBConnection()
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	rows, err := db.Query(get_activities)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	activities := make([]string, 0)
+
+	for rows.Next() {
+		var activity string
+		err = rows.Scan(&activity)
+		if err != nil {
+			return nil, err
+		}
+		activities = append(activities, activity)
+	}
+	return activities, rows.Err()
+}
+
 func setYearsOptions() error {
 	db, err := getDBConnection()
 	if err != nil {
@@ -286,22 +578,26 @@ func setYearsOptions() error {
 		latest = int(latestn.Int64)
 	}
 
-	yearOptions = make([]string, 0)
+	options := make([]string, 0)
 	if oldest == 0 {
-		yearOptions = append(yearOptions, fmt.Sprintf("%d", time.Now().Year()))
-		return nil
+		options = append(options, fmt.Sprintf("%d", time.Now().Year()))
 	} else {
-		if oldest == latest {
-			yearOptions = append(yearOptions, fmt.Sprintf("%d", oldest))
-			return nil
-		}
-
 		for i := oldest; i <= latest; i++ {
-			yearOptions = append(yearOptions, fmt.Sprintf("%d", i))
+			options = append(options, fmt.Sprintf("%d", i))
 		}
-
-		return nil
 	}
+
+	yearOptionsMu.Lock()
+	yearOptions = options
+	yearOptionsMu.Unlock()
+	return nil
+}
+
+// getYearOptions returns the years with sessions as of the last setYearsOptions
+func getYearOptions() []string {
+	yearOptionsMu.RLock()
+	defer yearOptionsMu.RUnlock()
+	return yearOptions
 }
 
 func getSegmentsFor(date string) ([]Segment, error) {
@@ -335,3 +631,356 @@ func getSegmentsFor(date string) ([]Segment, error) {
 
 	return segments, nil
 }
+
+// forEachSessionBetween calls fn for every closed session dated between from and to (inclusive)
+// in the order they were started, without loading them all into memory
+func forEachSessionBetween(from, to string, activities []string, fn func(Session) error) error {
+	db, err := getDBConnection()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	filter, filterArgs := activityFilterClause(activities)
+	args := append([]any{from, to}, filterArgs...)
+	rows, err := db.Query(fmt.Sprintf(get_sessions_between, filter), args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var session Session
+		err = rows.Scan(
+			&session.ID,
+			&session.Date,
+			&session.Activity,
+			&session.Start,
+			&session.End,
+		)
+		if err != nil {
+			return err
+		}
+		session.Start = session.Start.Local()
+		session.End = session.End.Local()
+		err = fn(session)
+		if err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+func getSessionsBetween(from, to string, activities []string) ([]Session, error) {
+	sessions := make([]Session, 0)
+	err := forEachSessionBetween(from, to, activities, func(session Session) error {
+		sessions = append(sessions, session)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return sessions, nil
+}
+
+// queryRower is satisfied by both *sql.DB and *sql.Tx
+type queryRower interface {
+	QueryRow(query string, args ...any) *sql.Row
+}
+
+// scanSession reads the session returned by query, the End of an active session being zero
+func scanSession(q queryRower, query string, args ...any) (*Session, error) {
+	var session Session
+	var end sql.NullTime
+	err := q.QueryRow(query, args...).Scan(&session.ID, &session.Date, &session.Activity, &session.Start, &end)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrSessionNotFound
+		}
+		return nil, err
+	}
+	session.Start = session.Start.Local()
+	if end.Valid {
+		session.End = end.Time.Local()
+	}
+	return &session, nil
+}
+
+func getSession(id int64) (*Session, error) {
+	db, err := getDBConnection()
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	return scanSession(db, get_session, id)
+}
+
+// getActiveSession returns the session in progress, or nil when there is none
+func getActiveSession() (*Session, error) {
+	db, err := getDBConnection()
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	session, err := scanSession(db, get_active_session)
+	if errors.Is(err, ErrSessionNotFound) {
+		return nil, nil
+	}
+	return session, err
+}
+
+// endActiveSession ends the session in progress and returns it, ErrSessionNotFound when there is none.
+// The update only matches a session still in progress, so a concurrent end can't end it twice
+func endActiveSession() (*Session, error) {
+	db, err := getDBConnection()
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var id int64
+	err = tx.QueryRow(end_active_session, time.Now().Unix()).Scan(&id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrSessionNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	session, err := scanSession(tx, get_session, id)
+	if err != nil {
+		return nil, err
+	}
+
+	return session, tx.Commit()
+}
+
+// addSession records a closed session, unless it overlaps another one
+func addSession(activity string, start, end time.Time) (*Session, error) {
+	db, err := getDBConnection()
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var count int
+	err = tx.QueryRow(count_overlapping_sessions, end.Unix(), start.Unix()).Scan(&count)
+	if err != nil {
+		return nil, err
+	}
+	if count > 0 {
+		return nil, ErrSessionOverlaps
+	}
+	result, err := tx.Exec(insert_session, start.Format("2006-01-02"), activity, start.Unix(), end.Unix())
+	if err != nil {
+		return nil, err
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+	return &Session{ID: id, Date: start.Format("2006-01-02"), Activity: activity, Start: start, End: end}, nil
+}
+
+// updateSession replaces the activity, start and end of a session, unless it would overlap another one.
+// An active session stays active when its End is zero. The session as it was before is returned
+func updateSession(session Session) (*Session, error) {
+	db, err := getDBConnection()
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	previous, err := scanSession(tx, get_session, session.ID)
+	if err != nil {
+		return nil, err
+	}
+	// an active session runs until now as far as overlaps are concerned
+	end, stop := session.End, any(session.End.Unix())
+	if session.End.IsZero() {
+		end, stop = time.Now(), nil
+	}
+	var count int
+	err = tx.QueryRow(count_overlapping_sessions_except, end.Unix(), session.Start.Unix(), session.ID).Scan(&count)
+	if err != nil {
+		return nil, err
+	}
+	if count > 0 {
+		return nil, ErrSessionOverlaps
+	}
+	_, err = tx.Exec(update_session, session.Start.Format("2006-01-02"), session.Activity, session.Start.Unix(), stop, session.ID)
+	if err != nil {
+		return nil, err
+	}
+	return previous, tx.Commit()
+}
+
+// deleteSession removes a session, returning it
+func deleteSession(id int64) (*Session, error) {
+	db, err := getDBConnection()
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	session, err := scanSession(tx, get_session, id)
+	if err != nil {
+		return nil, err
+	}
+	_, err = tx.Exec(delete_session, id)
+	if err != nil {
+		return nil, err
+	}
+	return session, tx.Commit()
+}
+
+func addAPIToken(name, hash string) error {
+	db, err := getDBConnection()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	_, err = db.Exec(insert_api_token, name, hash, time.Now().Unix())
+	if err != nil && strings.Contains(err.Error(), "UNIQUE constraint failed: api_tokens.name") {
+		return fmt.Errorf("a token named %s already exists", name)
+	}
+	return err
+}
+
+func getAPITokens() ([]APIToken, error) {
+	db, err := getDBConnection()
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	rows, err := db.Query(get_api_tokens)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tokens := make([]APIToken, 0)
+	for rows.Next() {
+		var token APIToken
+		var createdAt int64
+		var lastUsedAt sql.NullInt64
+		err = rows.Scan(&token.ID, &token.Name, &createdAt, &lastUsedAt)
+		if err != nil {
+			return nil, err
+		}
+		token.CreatedAt = time.Unix(createdAt, 0)
+		if lastUsedAt.Valid {
+			token.LastUsedAt = time.Unix(lastUsedAt.Int64, 0)
+		}
+		tokens = append(tokens, token)
+	}
+	return tokens, rows.Err()
+}
+
+// revokeAPIToken deletes the token with the given id, telling if there was one
+func revokeAPIToken(id int64) (bool, error) {
+	db, err := getDBConnection()
+	if err != nil {
+		return false, err
+	}
+	defer db.Close()
+
+	result, err := db.Exec(delete_api_token, id)
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	return n > 0, err
+}
+
+// useAPIToken reports whether a token has the hash, recording when it was used. The time is only
+// written when the previous one is older than apiTokenUsageResolution, so that every api request
+// doesn't write to the database
+func useAPIToken(hash string) (bool, error) {
+	db, err := getDBConnection()
+	if err != nil {
+		return false, err
+	}
+	defer db.Close()
+
+	var id int64
+	var lastUsedAt sql.NullInt64
+	err = db.QueryRow(get_api_token_by_hash, hash).Scan(&id, &lastUsedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return false, nil
+		}
+		return false, err
+	}
+	now := time.Now()
+	if lastUsedAt.Valid && now.Sub(time.Unix(lastUsedAt.Int64, 0)) < apiTokenUsageResolution {
+		return true, nil
+	}
+	_, err = db.Exec(use_api_token, now.Unix(), id)
+	return err == nil, err
+}
+
+func addLoginSession(hash string, expires time.Time) error {
+	db, err := getDBConnection()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	_, err = db.Exec(insert_login_session, hash, expires.Unix())
+	return err
+}
+
+func loginSessionExists(hash string) (bool, error) {
+	db, err := getDBConnection()
+	if err != nil {
+		return false, err
+	}
+	defer db.Close()
+
+	var count int
+	err = db.QueryRow(count_login_sessions, hash, time.Now().Unix()).Scan(&count)
+	return count > 0, err
+}
+
+// deleteLoginSession ends a login session, along with the ones that expired
+func deleteLoginSession(hash string) error {
+	db, err := getDBConnection()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	_, err = db.Exec(delete_login_session, hash, time.Now().Unix())
+	return err
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+)
+
+// errors of the json api share one shape: {"error": message}, message being a string
+// or, for invalid input, an object mapping each invalid field to what's wrong with it
+
+func errorResponse(w http.ResponseWriter, r *http.Request, status int, message any) {
+	err := writeJSON(w, status, envelope{"error": message}, nil)
+	if err != nil {
+		log.Println(err.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+func serverErrorResponse(w http.ResponseWriter, r *http.Request, err error) {
+	log.Printf("%s %s: %v", r.Method, r.URL.RequestURI(), err)
+	errorResponse(w, r, http.StatusInternalServerError, "the server encountered a problem and could not process your request")
+}
+
+func notFoundResponse(w http.ResponseWriter, r *http.Request) {
+	errorResponse(w, r, http.StatusNotFound, "the requested resource could not be found")
+}
+
+func methodNotAllowedResponse(w http.ResponseWriter, r *http.Request) {
+	errorResponse(w, r, http.StatusMethodNotAllowed, fmt.Sprintf("the %s method is not supported for this resource", r.Method))
+}
+
+func badRequestResponse(w http.ResponseWriter, r *http.Request, err error) {
+	errorResponse(w, r, http.StatusBadRequest, err.Error())
+}
+
+func failedValidationResponse(w http.ResponseWriter, r *http.Request, errors map[string]string) {
+	errorResponse(w, r, http.StatusUnprocessableEntity, errors)
+}
+
+func conflictResponse(w http.ResponseWriter, r *http.Request, err error) {
+	errorResponse(w, r, http.StatusConflict, err.Error())
+}
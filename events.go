@@ -0,0 +1,280 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// names of the events sent on /events
+const (
+	eventTick    = "tick"
+	eventStarted = "started"
+	eventEnded   = "ended"
+	eventEdited  = "edited"
+)
+
+const (
+	// how often the active session is read, sessions started or ended by the cli are noticed this fast
+	eventPollInterval = time.Second
+	// comment lines sent to idle streams so that proxies don't close them
+	eventKeepAliveInterval = 30 * time.Second
+	// events a slow subscriber can fall behind before it misses some
+	eventBufferSize = 16
+)
+
+type sseMessage struct {
+	Name string
+	Data []byte
+}
+
+// eventHub fans out the session events to the pages subscribed to /events
+type eventHub struct {
+	mu          sync.Mutex
+	subscribers map[chan sseMessage]struct{}
+	done        chan struct{}
+	closeOnce   sync.Once
+}
+
+var sessionEvents = newEventHub()
+
+func newEventHub() *eventHub {
+	return &eventHub{
+		subscribers: make(map[chan sseMessage]struct{}),
+		done:        make(chan struct{}),
+	}
+}
+
+func (h *eventHub) subscribe() chan sseMessage {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	ch := make(chan sseMessage, eventBufferSize)
+	h.subscribers[ch] = struct{}{}
+	return ch
+}
+
+func (h *eventHub) unsubscribe(ch chan sseMessage) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.subscribers, ch)
+}
+
+func (h *eventHub) hasSubscribers() bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return len(h.subscribers) > 0
+}
+
+// close ends the streams of every subscriber and stops watch, so that the server can shut down
+func (h *eventHub) close() {
+	h.closeOnce.Do(func() {
+		close(h.done)
+	})
+}
+
+// publish sends an event to every subscriber, the ones too slow to keep up miss it
+func (h *eventHub) publish(name string, event SessionEvent) {
+	data, err := json.Marshal(event)
+	if err != nil {
+		log.Println(err.Error())
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for ch := range h.subscribers {
+		select {
+		case ch <- sseMessage{Name: name, Data: data}:
+		default:
+		}
+	}
+}
+
+// publishSession refreshes the cached charts showing dates and tells the subscribers that session
+// changed, sending them the new heatmap cells and, when the active session changed, its card
+func (h *eventHub) publishSession(name string, session *Session, dates ...string) {
+	refreshChartData(dates...)
+	if !h.hasSubscribers() {
+		return
+	}
+
+	var event SessionEvent
+	if session != nil {
+		sr := newSessionResponse(session)
+		event.Session = &sr
+	}
+
+	var card []byte
+	var err error
+	switch {
+	case session != nil && session.End.IsZero():
+		event.Elapsed = int64(time.Since(session.Start).Seconds())
+		card, err = renderEndSessionAction(session.Activity)
+	case name == eventEnded:
+		card, err = renderStartSessionAction()
+	}
+	if err != nil {
+		log.Println(err.Error())
+		return
+	}
+	event.Card = string(card)
+
+	event.Days, err = dayCells(dates)
+	if err != nil {
+		log.Println(err.Error())
+		return
+	}
+
+	h.publish(name, event)
+}
+
+// publishDays tells the subscribers the totals of dates changed, e.g. after sessions were imported or edited
+func (h *eventHub) publishDays(dates []string) {
+	if len(dates) == 0 || !h.hasSubscribers() {
+		return
+	}
+	days, err := dayCells(dates)
+	if err != nil {
+		log.Println(err.Error())
+		return
+	}
+	h.publish(eventEdited, SessionEvent{Days: days})
+}
+
+// dayCells are the heatmap cells of dates, each one listed once
+func dayCells(dates []string) ([]DayCell, error) {
+	seen := make(map[string]bool)
+	cells := make([]DayCell, 0, len(dates))
+	for _, date := range dates {
+		if date == "" || seen[date] {
+			continue
+		}
+		seen[date] = true
+		cell, err := dayCell(date)
+		if err != nil {
+			return nil, err
+		}
+		cells = append(cells, cell)
+	}
+	return cells, nil
+}
+
+// dayCell is the heatmap cell of date, with the tooltip listing its activities
+func dayCell(date string) (DayCell, error) {
+	da, err := computeDayActivities(date)
+	if err != nil {
+		return DayCell{}, err
+	}
+	tooltip, err := renderDayTooltip(da)
+	if err != nil {
+		return DayCell{}, err
+	}
+	return DayCell{Date: date, Level: da.Level, Tooltip: string(tooltip), Color: da.Color}, nil
+}
+
+// watch polls the active session while pages are subscribed, so that sessions started, ended
+// or edited by the cli or the api are pushed as well, and sends a tick every second a session is active
+func (h *eventHub) watch() {
+	ticker := time.NewTicker(eventPollInterval)
+	defer ticker.Stop()
+
+	// whether last is the active session as of the previous poll, it isn't once nobody is subscribed
+	known := false
+	var last *Session
+	for {
+		select {
+		case <-h.done:
+			return
+		case <-ticker.C:
+		}
+		if !h.hasSubscribers() {
+			known = false
+			continue
+		}
+		current, err := getActiveSession()
+		if err != nil {
+			log.Println(err.Error())
+			continue
+		}
+		if known {
+			h.compare(last, current)
+		}
+		known = true
+		last = current
+
+		if current != nil {
+			sr := newSessionResponse(current)
+			h.publish(eventTick, SessionEvent{Session: &sr, Elapsed: int64(time.Since(current.Start).Seconds())})
+		}
+	}
+}
+
+// compare publishes what happened between two polls of the active session
+func (h *eventHub) compare(last, current *Session) {
+	if last != nil && (current == nil || current.ID != last.ID) {
+		ended, err := getSession(last.ID)
+		if err != nil {
+			// the session was deleted rather than ended
+			ended = nil
+		}
+		h.publishSession(eventEnded, ended, last.Date)
+		if current != nil {
+			// started right after, the card ends up being the one of the new session
+			h.publishSession(eventStarted, current, current.Date)
+		}
+		return
+	}
+	if current == nil {
+		return
+	}
+	if last == nil {
+		h.publishSession(eventStarted, current, current.Date)
+		return
+	}
+	if !current.Start.Equal(last.Start) || current.Activity != last.Activity || current.Date != last.Date {
+		h.publishSession(eventEdited, current, last.Date, current.Date)
+	}
+}
+
+// eventsHandler streams the session events as Server-Sent Events until the page is closed
+func eventsHandler(w http.ResponseWriter, r *http.Request) {
+	flusher, OK := w.(http.Flusher)
+	if !OK {
+		http.Error(w, "Streaming Unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	ch := sessionEvents.subscribe()
+	defer sessionEvents.unsubscribe(ch)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	// browsers reconnect this long after the stream is cut
+	fmt.Fprint(w, "retry: 3000\n\n")
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(eventKeepAliveInterval)
+	defer keepAlive.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-sessionEvents.done:
+			return
+		case msg := <-ch:
+			_, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", msg.Name, msg.Data)
+			if err != nil {
+				return
+			}
+		case <-keepAlive.C:
+			_, err := fmt.Fprint(w, ": keep-alive\n\n")
+			if err != nil {
+				return
+			}
+		}
+		flusher.Flush()
+	}
+}
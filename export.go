@@ -0,0 +1,232 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strings"
+	"time"
+)
+
+// exporter writes sessions or daily totals to w one at a time, so that the
+// whole database never needs to be held in memory
+type exporter interface {
+	WriteSession(session Session) error
+	WriteDailyTotal(total ActivitySession) error
+	// Close flushes whatever the format needs to terminate the output
+	Close() error
+}
+
+// exporters by the name of the format they write
+var exporters = map[string]func(w io.Writer) exporter{
+	"csv":       newCSVExporter,
+	"ics":       newICSExporter,
+	"json":      newJSONExporter,
+	"jsonl":     newJSONLExporter,
+	"timeclock": newTimeclockExporter,
+}
+
+func exportFormats() string {
+	formats := make([]string, 0, len(exporters))
+	for format := range exporters {
+		formats = append(formats, format)
+	}
+	sort.Strings(formats)
+	return strings.Join(formats, ", ")
+}
+
+// exportSessions writes every closed session dated between from and to (inclusive) to w,
+// or the time spent on each activity per day when daily is set
+func exportSessions(w io.Writer, format, from, to string, activities []string, daily bool) error {
+	newExporter, OK := exporters[format]
+	if !OK {
+		return fmt.Errorf("invalid format %q, expected one of %s", format, exportFormats())
+	}
+	bw := bufio.NewWriter(w)
+	e := newExporter(bw)
+
+	activities = normalizeActivities(activities)
+	var err error
+	if daily {
+		err = forEachDailyTotalBetween(from, to, activities, e.WriteDailyTotal)
+	} else {
+		err = forEachSessionBetween(from, to, activities, e.WriteSession)
+	}
+	if err != nil {
+		return err
+	}
+	err = e.Close()
+	if err != nil {
+		return err
+	}
+	return bw.Flush()
+}
+
+// exportField is a named value of an exported record, records keep their fields in order
+type exportField struct {
+	Name  string
+	Value any
+}
+
+func sessionRecord(session Session) []exportField {
+	return []exportField{
+		{"id", session.ID},
+		{"date", session.Date},
+		{"activity", session.Activity},
+		{"start", session.Start.Format(time.RFC3339)},
+		{"end", session.End.Format(time.RFC3339)},
+		{"minutes", roundMinutes(session.Duration().Minutes())},
+	}
+}
+
+func dailyTotalRecord(total ActivitySession) []exportField {
+	return []exportField{
+		{"date", total.Date},
+		{"activity", total.Activity},
+		{"minutes", roundMinutes(float64(total.Duration))},
+	}
+}
+
+func roundMinutes(minutes float64) float64 {
+	return math.Round(minutes*100) / 100
+}
+
+type csvExporter struct {
+	w             *csv.Writer
+	headerWritten bool
+}
+
+func newCSVExporter(w io.Writer) exporter {
+	return &csvExporter{w: csv.NewWriter(w)}
+}
+
+func (e *csvExporter) writeRecord(record []exportField) error {
+	if !e.headerWritten {
+		header := make([]string, len(record))
+		for i, field := range record {
+			header[i] = field.Name
+		}
+		err := e.w.Write(header)
+		if err != nil {
+			return err
+		}
+		e.headerWritten = true
+	}
+	row := make([]string, len(record))
+	for i, field := range record {
+		row[i] = fmt.Sprint(field.Value)
+	}
+	return e.w.Write(row)
+}
+
+func (e *csvExporter) WriteSession(session Session) error {
+	return e.writeRecord(sessionRecord(session))
+}
+
+func (e *csvExporter) WriteDailyTotal(total ActivitySession) error {
+	return e.writeRecord(dailyTotalRecord(total))
+}
+
+func (e *csvExporter) Close() error {
+	e.w.Flush()
+	return e.w.Error()
+}
+
+// marshalRecord encodes a record as a json object keeping the order of its fields
+func marshalRecord(record []exportField) ([]byte, error) {
+	var sb strings.Builder
+	sb.WriteByte('{')
+	for i, field := range record {
+		if i > 0 {
+			sb.WriteByte(',')
+		}
+		name, err := json.Marshal(field.Name)
+		if err != nil {
+			return nil, err
+		}
+		value, err := json.Marshal(field.Value)
+		if err != nil {
+			return nil, err
+		}
+		sb.Write(name)
+		sb.WriteByte(':')
+		sb.Write(value)
+	}
+	sb.WriteByte('}')
+	return []byte(sb.String()), nil
+}
+
+// jsonExporter writes a single array, element by element
+type jsonExporter struct {
+	w       io.Writer
+	records int
+}
+
+func newJSONExporter(w io.Writer) exporter {
+	return &jsonExporter{w: w}
+}
+
+func (e *jsonExporter) writeRecord(record []exportField) error {
+	js, err := marshalRecord(record)
+	if err != nil {
+		return err
+	}
+	separator := ",\n\t"
+	if e.records == 0 {
+		separator = "[\n\t"
+	}
+	e.records++
+	_, err = fmt.Fprintf(e.w, "%s%s", separator, js)
+	return err
+}
+
+func (e *jsonExporter) WriteSession(session Session) error {
+	return e.writeRecord(sessionRecord(session))
+}
+
+func (e *jsonExporter) WriteDailyTotal(total ActivitySession) error {
+	return e.writeRecord(dailyTotalRecord(total))
+}
+
+func (e *jsonExporter) Close() error {
+	closing := "\n]\n"
+	if e.records == 0 {
+		closing = "[]\n"
+	}
+	_, err := io.WriteString(e.w, closing)
+	return err
+}
+
+// jsonlExporter writes one json object per line
+type jsonlExporter struct {
+	w io.Writer
+}
+
+func newJSONLExporter(w io.Writer) exporter {
+	return &jsonlExporter{w: w}
+}
+
+func (e *jsonlExporter) writeRecord(record []exportField) error {
+	js, err := marshalRecord(record)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(e.w, "%s\n", js)
+	return err
+}
+
+func (e *jsonlExporter) WriteSession(session Session) error {
+	return e.writeRecord(sessionRecord(session))
+}
+
+func (e *jsonlExporter) WriteDailyTotal(total ActivitySession) error {
+	return e.writeRecord(dailyTotalRecord(total))
+}
+
+func (e *jsonlExporter) Close() error {
+	return nil
+}
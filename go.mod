@@ -8,9 +8,11 @@ require (
 	github.com/alexeyco/simpletable v1.0.0
 	github.com/go-chi/chi/v5 v5.2.3
 	github.com/mattn/go-sqlite3 v1.14.32
+	golang.org/x/term v0.34.0
 )
 
 require (
 	github.com/mattn/go-runewidth v0.0.17 // indirect
 	github.com/rivo/uniseg v0.4.7 // indirect
+	golang.org/x/sys v0.35.0 // indirect
 )
@@ -2,29 +2,18 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
+	"html/template"
+	"io"
 	"net/http"
+	"regexp"
+	"sort"
 	"strconv"
-	"text/template"
+	"strings"
 	"time"
 )
 
-var months = map[time.Month]int{
-	time.January:   31,
-	time.February:  28,
-	time.March:     31,
-	time.April:     30,
-	time.May:       31,
-	time.June:      30,
-	time.July:      31,
-	time.August:    31,
-	time.September: 30,
-	time.October:   31,
-	time.November:  30,
-	time.December:  31,
-}
-
 func startSession(activityName string) (string, error) {
 	activeSessionActivity, err := createActivitySession(activityName)
 	if err != nil {
@@ -66,36 +55,99 @@ func computeTemplateData() (*TemplateData, error) {
 		return nil, err
 	}
 	tmplData.ActiveSession = as
-	mu.Lock()
-	defer mu.Unlock()
-	chartData, OK := chartDataByYear[currentYear]
-	if !OK {
-		cd, err := computeChartDataForYear(currentYear)
-		if err != nil {
-			return nil, err
-		}
-		chartDataByYear[currentYear] = cd
-		chartData = cd
+	// the home page opens on the rolling window so the chart is never empty in January
+	chartData, err := getChartData(ROLLING_YEAR, nil)
+	if err != nil {
+		return nil, err
 	}
 	tmplData.CurrentYearActivityChartData = chartData
 	return tmplData, nil
 }
 
-func computeChartDataForYear(year string) (*ActivityChartData, error) {
-	as, err := getTimeSpentOnEachActivityEverydayForYear(year)
+// normalizeActivities trims, de-duplicates and sorts the activity filters
+// so that the same selection always maps to the same cache entry
+func normalizeActivities(activities []string) []string {
+	seen := make(map[string]bool)
+	normalized := make([]string, 0, len(activities))
+	for _, activity := range activities {
+		activity = strings.TrimSpace(activity)
+		if activity == "" || seen[activity] {
+			continue
+		}
+		seen[activity] = true
+		normalized = append(normalized, activity)
+	}
+	sort.Strings(normalized)
+	return normalized
+}
+
+func newChartDataKey(year string, activities []string) chartDataKey {
+	if year == ROLLING_YEAR {
+		// the rolling window moves every day, so it is cached per day
+		year = fmt.Sprintf("%s@%s", ROLLING_YEAR, time.Now().Format("2006-01-02"))
+	}
+	return chartDataKey{
+		Year:       year,
+		Activities: strings.Join(normalizeActivities(activities), "\x00"),
+	}
+}
+
+// chartWindow resolves the year option into the first and last day shown by the chart.
+// year is either a calendar year or ROLLING_YEAR for the 365 days ending today
+func chartWindow(year string, now time.Time) (time.Time, time.Time, string, error) {
+	if year == ROLLING_YEAR {
+		end := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+		start := end.AddDate(0, 0, -364)
+		return start, end, "the last 12 months", nil
+	}
+	y, err := strconv.Atoi(year)
+	if err != nil {
+		return time.Time{}, time.Time{}, "", err
+	}
+	start := time.Date(y, time.January, 1, 0, 0, 0, 0, time.UTC)
+	end := time.Date(y, time.December, 31, 0, 0, 0, 0, time.UTC)
+	return start, end, year, nil
+}
+
+func computeChartDataForYear(year string, activities []string) (*ActivityChartData, error) {
+	activities = normalizeActivities(activities)
+	start, end, title, err := chartWindow(year, time.Now())
 	if err != nil {
 		return nil, err
 	}
-	y, err := strconv.Atoi(year)
+	as, err := getTimeSpentOnEachActivityEverydayBetween(start.Format("2006-01-02"), end.Format("2006-01-02"), activities)
+	if err != nil {
+		return nil, err
+	}
+	activityOptions, err := getActivities()
+	if err != nil {
+		return nil, err
+	}
+	weekStart, err := getWeekStart()
+	if err != nil {
+		return nil, err
+	}
+	palettes, err := getPalettes()
 	if err != nil {
 		return nil, err
 	}
 	//
-	activityChartData := transformActiveSessionsToActivityChartData(y, as)
-	activityChartData.YearOptions = yearOptions
+	activityChartData := transformActiveSessionsToActivityChartData(start, end, weekStart, as)
+	for _, da := range activityChartData.days {
+		applyPalettes(palettes, da)
+	}
+	activityChartData.Year = year
+	activityChartData.RollingYear = ROLLING_YEAR
+	activityChartData.Title = title
+	activityChartData.YearOptions = getYearOptions()
+	activityChartData.ActivityOptions = activityOptions
+	activityChartData.Activities = activities
 	return activityChartData, nil
 }
 
+// highest heatmap level, reached past 5 hours
+const maxLevel = 6
+
 func getLevel(k float32) int {
 	if k == float32(0) {
 		return 0
@@ -118,62 +170,57 @@ func getLevel(k float32) int {
 	return 6
 }
 
-func isLeapYear(year int) bool {
-	if year%4 == 0 {
-		if year%100 == 0 {
-			return year%400 == 0
-		}
-		return true
+// applyPalettes colors the days with the palette of the activity most time was spent on, when it has one
+func applyPalettes(palettes map[string][]string, days ...*DayActivities) {
+	if len(palettes) == 0 {
+		return
 	}
-	return false
-}
-
-func updateChartDataForCurrentYear(date string) error {
-	mu.Lock()
-	defer mu.Unlock()
-	cy := fmt.Sprintf("%d", time.Now().Year())
-	mwam, OK := chartDataByYear[cy]
-	if !OK {
-		mwam, err := computeChartDataForYear(cy)
-		if err != nil {
-			return err
+	for _, da := range days {
+		if da.Level == 0 {
+			continue
+		}
+		top := ""
+		for activity, sessionDuration := range da.Activities {
+			if top == "" || sessionDuration.Minutes > da.Activities[top].Minutes ||
+				(sessionDuration.Minutes == da.Activities[top].Minutes && activity < top) {
+				top = activity
+			}
+		}
+		if palette, OK := palettes[top]; OK && len(palette) >= da.Level {
+			da.Color = palette[da.Level-1]
 		}
-		chartDataByYear[cy] = mwam
-		return nil
 	}
+}
 
-	todaysSummary, err := getTimeSpentOnEachActivityFor(date)
+// computeDayActivities sums up the time spent on each activity on date
+func computeDayActivities(date string) (*DayActivities, error) {
+	summary, err := getTimeSpentOnEachActivityFor(date)
 	if err != nil {
-		return err
+		return nil, err
+	}
+	da := &DayActivities{
+		Date:       date,
+		Activities: make(map[string]SessionDuration),
 	}
-	activities := make(map[string]SessionDuration)
-	totalHours := float32(0)
-	for _, activitySession := range todaysSummary {
+	for _, activitySession := range summary {
 		sessionDuration := SessionDuration{
 			DurationPercentage: int(activitySession.Duration * 100 / 1440),
 			DurationStr:        activitySession.DurationStr,
+			Minutes:            activitySession.Duration,
 		}
-		activities[activitySession.Activity] = sessionDuration
-		totalHours += (activitySession.Duration / 60)
+		da.Activities[activitySession.Activity] = sessionDuration
+		da.TotalHours += (activitySession.Duration / 60)
 	}
-
-	t, err := time.Parse("2006-01-02", date)
+	da.Level = getLevel(da.TotalHours)
+	palettes, err := getPalettes()
 	if err != nil {
-		log.Fatal(err)
+		return nil, err
 	}
-	month, dayNumber := t.Month(), t.Day()-1
-
-	mwam.MonthDailyActivities[month].DA[dayNumber].Date = date
-	mwam.MonthDailyActivities[month].DA[dayNumber].Activities = activities
-	mwam.MonthDailyActivities[month].DA[dayNumber].TotalHours = totalHours
-	mwam.MonthDailyActivities[month].DA[dayNumber].Level = getLevel(totalHours)
-
-	chartDataByYear[cy] = mwam
-
-	return nil
+	applyPalettes(palettes, da)
+	return da, nil
 }
 
-func transformActiveSessionsToActivityChartData(year int, activitySessions []ActivitySession) *ActivityChartData {
+func transformActiveSessionsToActivityChartData(start, end time.Time, weekStart time.Weekday, activitySessions []ActivitySession) *ActivityChartData {
 	daMap := make(map[string]*DayActivities)
 
 	for _, as := range activitySessions {
@@ -190,89 +237,247 @@ func transformActiveSessionsToActivityChartData(year int, activitySessions []Act
 		sessionDuration := SessionDuration{
 			DurationPercentage: int(as.Duration * 100 / 1440),
 			DurationStr:        as.DurationStr,
+			Minutes:            as.Duration,
 		}
 		da.Activities[as.Activity] = sessionDuration
 		da.TotalHours += (as.Duration / 60)
 		da.Level = getLevel(da.TotalHours)
 	}
 
-	monthDailyActivitiesMap := make(map[time.Month]struct {
-		Offset int
-		DA     []*DayActivities
-	})
-
-	for month, lastDay := range months {
-		days := make([]*DayActivities, 0)
-		ld := lastDay
-		if isLeapYear(year) {
-			ld += 1
+	// the grid starts on the week start on or before start so that every column is a whole week
+	days := make(map[string]*DayActivities)
+	weeks := make([][]*DayActivities, 0, 54)
+	monthLabels := make([]MonthLabel, 0, 13)
+	for current := startOfWeek(start, weekStart); !current.After(end); current = current.AddDate(0, 0, 1) {
+		row := weekdayRow(current.Weekday(), weekStart)
+		if row == 0 {
+			weeks = append(weeks, make([]*DayActivities, 7))
 		}
-		start := time.Date(year, month, 1, 0, 0, 0, 0, time.UTC)
-		end := time.Date(year, month, ld, 0, 0, 0, 0, time.UTC)
-		offset := int(start.Weekday())
-		current := start
-
-		// appending actual days of the year
-		for current.Before(end) || current.Equal(end) {
-			dateStr := current.Format("2006-01-02")
-			da, OK := daMap[dateStr]
-			if !OK {
-				da = &DayActivities{
-					Date:       dateStr,
-					TotalHours: 0,
-					Level:      getLevel(0),
-				}
+		if current.Before(start) {
+			continue
+		}
+
+		column := len(weeks) - 1
+		if current.Equal(start) || current.Day() == 1 {
+			// a month starting right after a partial first month would overlap its label
+			if n := len(monthLabels); n > 0 && column-monthLabels[n-1].Column < 3 {
+				monthLabels = monthLabels[:n-1]
 			}
-			days = append(days, da)
-			// increment the current by one day
-			current = current.Add(24 * time.Hour)
+			monthLabels = append(monthLabels, MonthLabel{
+				Label:  current.Format("Jan"),
+				Column: column,
+			})
 		}
 
-		monthDailyActivitiesMap[month] = struct {
-			Offset int
-			DA     []*DayActivities
-		}{
-			Offset: offset,
-			DA:     days,
+		dateStr := current.Format("2006-01-02")
+		da, OK := daMap[dateStr]
+		if !OK {
+			da = &DayActivities{
+				Date:       dateStr,
+				TotalHours: 0,
+				Level:      getLevel(0),
+			}
 		}
+		days[dateStr] = da
+		weeks[column][row] = da
 	}
+
+	// only every other weekday is labelled, like on GitHub
+	weekdayLabels := make([]string, 7)
+	for row := 1; row < 7; row += 2 {
+		weekdayLabels[row] = time.Weekday((int(weekStart) + row) % 7).String()[:3]
+	}
+
 	mwam := &ActivityChartData{
-		Year:                 fmt.Sprintf("%d", year),
-		MonthDailyActivities: monthDailyActivitiesMap,
+		From:          start.Format("2006-01-02"),
+		To:            end.Format("2006-01-02"),
+		Weeks:         weeks,
+		MonthLabels:   monthLabels,
+		WeekdayLabels: weekdayLabels,
+		WeekStart:     weekStart.String(),
+		days:          days,
 	}
 	return mwam
 }
 
-func initializeTemplates() {
-	// initialize all the homepage template
-	if tHomepage == nil {
-		tpl := template.Must(template.New("homepage").Funcs(funcMap).Parse(HOME_PAGE_HTML))
-		tHomepage = tpl
+// formatDuration formats d the same way durations are shown everywhere else, e.g. "1 hr(s) & 5 min(s)"
+func formatDuration(d time.Duration) string {
+	hours := int(d.Hours())
+	minutes := int(d.Minutes()) % 60
+	if minutes > 0 {
+		return fmt.Sprintf("%d hr(s) & %d min(s)", hours, minutes)
 	}
+	return fmt.Sprintf("%d hr(s)", hours)
+}
 
-	// initialize all the chart template
-	if tChart == nil {
-		tpl := template.Must(template.New("chart").Funcs(funcMap).Parse(ACTIVITY_CHART_HTML))
-		tChart = tpl
+// parseDateRange validates from and to (yyyy-mm-dd), to defaults to today
+// and from defaults to defaultDays days before to
+func parseDateRange(from, to string, defaultDays int) (string, string, error) {
+	end := time.Now()
+	if to != "" {
+		t, err := time.Parse("2006-01-02", to)
+		if err != nil {
+			return "", "", fmt.Errorf("invalid date %q, expected yyyy-mm-dd", to)
+		}
+		end = t
 	}
+	start := end.AddDate(0, 0, -defaultDays)
+	if from != "" {
+		t, err := time.Parse("2006-01-02", from)
+		if err != nil {
+			return "", "", fmt.Errorf("invalid date %q, expected yyyy-mm-dd", from)
+		}
+		start = t
+	}
+	from, to = start.Format("2006-01-02"), end.Format("2006-01-02")
+	if from > to {
+		return "", "", fmt.Errorf("the start date %s is after the end date %s", from, to)
+	}
+	return from, to, nil
+}
+
+// weekdayRow returns the position of day within a week beginning on weekStart
+func weekdayRow(day, weekStart time.Weekday) int {
+	return (int(day) - int(weekStart) + 7) % 7
+}
+
+// startOfWeek returns the first day of the week containing t
+func startOfWeek(t time.Time, weekStart time.Weekday) time.Time {
+	y, m, d := t.Date()
+	return time.Date(y, m, d-weekdayRow(t.Weekday(), weekStart), 0, 0, 0, 0, t.Location())
+}
+
+// parseWeekday accepts full or three-letter weekday names in any case
+func parseWeekday(s string) (time.Weekday, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	for day := time.Sunday; day <= time.Saturday; day++ {
+		name := strings.ToLower(day.String())
+		if s == name || s == name[:3] {
+			return day, nil
+		}
+	}
+	return time.Sunday, fmt.Errorf("invalid weekday %q", s)
+}
+
+// getWeekStart returns the configured first day of the week used by the heatmap and the weekly reports
+func getWeekStart() (time.Weekday, error) {
+	value, err := getSetting(SETTING_WEEK_START)
+	if err != nil {
+		return time.Sunday, err
+	}
+	return parseWeekday(value)
+}
+
+// validateSetting rejects unknown settings and values the application can't use
+func validateSetting(key, value string) error {
+	switch key {
+	case SETTING_WEEK_START:
+		_, err := parseWeekday(value)
+		return err
+	case SETTING_THEME:
+		return validateTheme(value)
+	case SETTING_THEME_DIR:
+		if value == "" {
+			return nil
+		}
+		_, err := newThemeFS(value)
+		return err
+	default:
+		if strings.HasPrefix(key, SETTING_PALETTE_PREFIX) && len(key) > len(SETTING_PALETTE_PREFIX) {
+			return validatePalette(value)
+		}
+		return fmt.Errorf("unknown setting %q", key)
+	}
+}
+
+// validateTheme checks that value is one of the built-in themes or of those of the theme directory
+func validateTheme(value string) error {
+	dir, err := getSetting(SETTING_THEME_DIR)
+	if err != nil {
+		return err
+	}
+	fsys, err := newThemeFS(dir)
+	if err != nil {
+		return err
+	}
+	themes, err := themeNames(fsys)
+	if err != nil {
+		return err
+	}
+	if !contains(themes, value) {
+		return fmt.Errorf("unknown theme %q, available themes are %s", value, strings.Join(themes, ", "))
+	}
+	return nil
+}
+
+// hex colors allowed in palettes, they end up in style attributes so nothing else is accepted
+var paletteColorRegexp = regexp.MustCompile(`^#([0-9a-f]{3}|[0-9a-f]{6})$`)
 
-	// initialize all the chart404 template
-	if tChart404 == nil {
-		tpl := template.Must(template.New("chart404").Parse(NO_ACTIVITY_DATA_FOUND_HTML))
-		tChart404 = tpl
+// validatePalette checks that value lists a color for each of the heatmap levels above 0,
+// an empty value going back to the colors of the theme
+func validatePalette(value string) error {
+	if value == "" {
+		return nil
+	}
+	colors := strings.Split(value, ",")
+	if len(colors) != maxLevel {
+		return fmt.Errorf("a palette needs %d comma separated colors, from the least to the most time tracked, got %d", maxLevel, len(colors))
 	}
+	for _, color := range colors {
+		if !paletteColorRegexp.MatchString(color) {
+			return fmt.Errorf("invalid color %q, colors are written #rgb or #rrggbb", color)
+		}
+	}
+	return nil
+}
 
-	// initialize all the end session template
-	if tEndSessionAction == nil {
-		tpl := template.Must(template.New("endSession").Funcs(funcMap).Parse(END_ACTIVITY_HTML))
-		tEndSessionAction = tpl
+// getChartData returns the chart of a year narrowed down to activities, computing it when it isn't cached
+func getChartData(year string, activities []string) (*ActivityChartData, error) {
+	return charts.get(newChartDataKey(year, activities), func() (*ActivityChartData, error) {
+		return computeChartDataForYear(year, activities)
+	})
+}
+
+// initializeTemplates parses the templates, those of the theme directory replacing the embedded ones
+func initializeTemplates() error {
+	err := loadTheme()
+	if err != nil {
+		return err
 	}
 
-	// initialize all the start session template
-	if tStartSessionAction == nil {
-		tpl := template.Must(template.New("startSession").Parse(START_ACTIVITY_HTML))
-		tStartSessionAction = tpl
+	templates := []struct {
+		tpl   **template.Template
+		files []string
+	}{
+		{&tHomepage, []string{"home.html", "heatmap.html"}},
+		{&tChart, []string{"chart.html", "heatmap.html"}},
+		{&tStats, []string{"stats.html"}},
+		{&tCompare, []string{"compare.html"}},
+		{&tReview, []string{"review.html"}},
+		{&tLogin, []string{"login.html"}},
+		{&tBadge, []string{"badge.svg"}},
+		{&tChart404, []string{"chart_404.html"}},
+		{&tEndSessionAction, []string{"end_session.html"}},
+		{&tStartSessionAction, []string{"start_session.html"}},
 	}
+	for _, t := range templates {
+		if *t.tpl != nil {
+			continue
+		}
+		tpl, err := parseTemplates(t.files...)
+		if err != nil {
+			return fmt.Errorf("error parsing the %s template: %v", t.files[0], err)
+		}
+		*t.tpl = tpl
+	}
+	if tReviewMarkdown == nil {
+		tpl, err := parseTextTemplates("review.md")
+		if err != nil {
+			return fmt.Errorf("error parsing the review.md template: %v", err)
+		}
+		tReviewMarkdown = tpl
+	}
+	return nil
 }
 
 type envelope map[string]interface{}
@@ -295,3 +500,42 @@ func writeJSON(w http.ResponseWriter, status int, data envelope, headers http.He
 
 	return nil
 }
+
+// readJSON decodes the body of r, a single json object with known fields, into dst
+func readJSON(w http.ResponseWriter, r *http.Request, dst any) error {
+	r.Body = http.MaxBytesReader(w, r.Body, 1<<20)
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+
+	err := dec.Decode(dst)
+	if err != nil {
+		var syntaxError *json.SyntaxError
+		var unmarshalTypeError *json.UnmarshalTypeError
+		var maxBytesError *http.MaxBytesError
+		switch {
+		case errors.As(err, &syntaxError):
+			return fmt.Errorf("body contains badly-formed JSON (at character %d)", syntaxError.Offset)
+		case errors.Is(err, io.ErrUnexpectedEOF):
+			return errors.New("body contains badly-formed JSON")
+		case errors.As(err, &unmarshalTypeError):
+			if unmarshalTypeError.Field != "" {
+				return fmt.Errorf("body contains incorrect JSON type for field %q", unmarshalTypeError.Field)
+			}
+			return fmt.Errorf("body contains incorrect JSON type (at character %d)", unmarshalTypeError.Offset)
+		case errors.Is(err, io.EOF):
+			return errors.New("body must not be empty")
+		case strings.HasPrefix(err.Error(), "json: unknown field "):
+			return fmt.Errorf("body contains unknown key %s", strings.TrimPrefix(err.Error(), "json: unknown field "))
+		case errors.As(err, &maxBytesError):
+			return fmt.Errorf("body must not be larger than %d bytes", maxBytesError.Limit)
+		default:
+			return err
+		}
+	}
+
+	err = dec.Decode(&struct{}{})
+	if !errors.Is(err, io.EOF) {
+		return errors.New("body must only contain a single JSON value")
+	}
+	return nil
+}
@@ -0,0 +1,655 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const icsTimeLayout = "20060102T150405Z"
+
+// icsExporter writes sessions as the events of an iCalendar (RFC 5545) calendar
+type icsExporter struct {
+	w             io.Writer
+	headerWritten bool
+	stamp         string
+	err           error
+}
+
+func newICSExporter(w io.Writer) exporter {
+	return &icsExporter{w: w, stamp: time.Now().UTC().Format(icsTimeLayout)}
+}
+
+// writeLine writes a content line ending in CRLF, folding it so that no line is longer than 75 octets
+func (e *icsExporter) writeLine(line string) {
+	if e.err != nil {
+		return
+	}
+	var sb strings.Builder
+	width := 0
+	for _, r := range line {
+		size := utf8.RuneLen(r)
+		if width+size > 75 {
+			sb.WriteString("\r\n ")
+			width = 1
+		}
+		sb.WriteRune(r)
+		width += size
+	}
+	sb.WriteString("\r\n")
+	_, e.err = io.WriteString(e.w, sb.String())
+}
+
+func (e *icsExporter) writeHeader() {
+	if e.headerWritten {
+		return
+	}
+	e.headerWritten = true
+	e.writeLine("BEGIN:VCALENDAR")
+	e.writeLine("VERSION:2.0")
+	e.writeLine("PRODID:-//gotimeit//gotimeit//EN")
+	e.writeLine("CALSCALE:GREGORIAN")
+	e.writeLine("X-WR-CALNAME:gotimeit")
+}
+
+// icsEscape escapes the characters with a meaning in text values
+func icsEscape(s string) string {
+	return strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`).Replace(s)
+}
+
+func (e *icsExporter) WriteSession(session Session) error {
+	e.writeHeader()
+	e.writeLine("BEGIN:VEVENT")
+	e.writeLine(fmt.Sprintf("UID:session-%d@gotimeit", session.ID))
+	e.writeLine("DTSTAMP:" + e.stamp)
+	e.writeLine("DTSTART:" + session.Start.UTC().Format(icsTimeLayout))
+	e.writeLine("DTEND:" + session.End.UTC().Format(icsTimeLayout))
+	e.writeLine("SUMMARY:" + icsEscape(session.Activity))
+	// sessions carry no notes, the description tells how long the session lasted
+	e.writeLine("DESCRIPTION:" + icsEscape(fmt.Sprintf("%s of %s", formatDuration(session.Duration()), session.Activity)))
+	e.writeLine("TRANSP:TRANSPARENT")
+	e.writeLine("END:VEVENT")
+	return e.err
+}
+
+// WriteDailyTotal writes the time spent on an activity in a day as an all day event
+func (e *icsExporter) WriteDailyTotal(total ActivitySession) error {
+	day, err := time.Parse("2006-01-02", total.Date)
+	if err != nil {
+		return err
+	}
+	duration := time.Duration(float64(total.Duration) * float64(time.Minute))
+	e.writeHeader()
+	e.writeLine("BEGIN:VEVENT")
+	e.writeLine(fmt.Sprintf("UID:daily-%s-%s@gotimeit", day.Format("20060102"), strings.Join(strings.Fields(total.Activity), "-")))
+	e.writeLine("DTSTAMP:" + e.stamp)
+	e.writeLine("DTSTART;VALUE=DATE:" + day.Format("20060102"))
+	e.writeLine("DTEND;VALUE=DATE:" + day.AddDate(0, 0, 1).Format("20060102"))
+	e.writeLine("SUMMARY:" + icsEscape(fmt.Sprintf("%s: %s", total.Activity, formatDuration(duration))))
+	e.writeLine("TRANSP:TRANSPARENT")
+	e.writeLine("END:VEVENT")
+	return e.err
+}
+
+func (e *icsExporter) Close() error {
+	e.writeHeader()
+	e.writeLine("END:VCALENDAR")
+	return e.err
+}
+
+// icsProperty is a content line of a calendar, e.g. DTSTART;TZID=Europe/Paris:20261019T090000
+type icsProperty struct {
+	Name   string
+	Params map[string]string
+	Value  string
+}
+
+// icsEvent is a VEVENT, Row being the line it begins on
+type icsEvent struct {
+	Row        int
+	Properties map[string][]icsProperty
+}
+
+func (e icsEvent) get(name string) (icsProperty, bool) {
+	properties := e.Properties[name]
+	if len(properties) == 0 {
+		return icsProperty{}, false
+	}
+	return properties[0], true
+}
+
+// icsUnescape reverses icsEscape
+func icsUnescape(s string) string {
+	return strings.NewReplacer(`\\`, `\`, `\;`, ";", `\,`, ",", `\n`, "\n", `\N`, "\n").Replace(s)
+}
+
+// parseICSLine splits a content line into its name, parameters and value, colons and
+// semicolons within quoted parameter values being part of the value
+func parseICSLine(line string) (icsProperty, error) {
+	property := icsProperty{Params: make(map[string]string)}
+	quoted := false
+	start := 0
+	var name string
+	for i, r := range line {
+		switch {
+		case r == '"':
+			quoted = !quoted
+		case quoted:
+		case r == ';' || r == ':':
+			part := line[start:i]
+			if name == "" {
+				name = part
+			} else {
+				key, value, _ := strings.Cut(part, "=")
+				property.Params[strings.ToUpper(key)] = strings.Trim(value, `"`)
+			}
+			start = i + 1
+			if r == ':' {
+				property.Name = strings.ToUpper(name)
+				property.Value = line[start:]
+				return property, nil
+			}
+		}
+	}
+	return property, fmt.Errorf("invalid content line %q", line)
+}
+
+// readICSEvents reads the events of a calendar, unfolding its lines. Components nested
+// in events, like alarms, are ignored
+func readICSEvents(r io.Reader) ([]icsEvent, error) {
+	lines := make([]string, 0)
+	rows := make([]int, 0)
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	row := 0
+	for scanner.Scan() {
+		row++
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")) && len(lines) > 0 {
+			lines[len(lines)-1] += line[1:]
+			continue
+		}
+		if line == "" {
+			continue
+		}
+		lines = append(lines, line)
+		rows = append(rows, row)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	events := make([]icsEvent, 0)
+	var event *icsEvent
+	depth := 0
+	for i, line := range lines {
+		property, err := parseICSLine(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", rows[i], err)
+		}
+		switch {
+		case property.Name == "BEGIN" && strings.EqualFold(property.Value, "VEVENT") && event == nil:
+			event = &icsEvent{Row: rows[i], Properties: make(map[string][]icsProperty)}
+		case event == nil:
+		case property.Name == "BEGIN":
+			depth++
+		case property.Name == "END" && depth > 0:
+			depth--
+		case property.Name == "END":
+			events = append(events, *event)
+			event = nil
+		case depth == 0:
+			event.Properties[property.Name] = append(event.Properties[property.Name], property)
+		}
+	}
+	if event != nil {
+		return nil, fmt.Errorf("line %d: the event never ends", event.Row)
+	}
+	return events, nil
+}
+
+// parseICSTime parses a DATE or DATE-TIME value in UTC, in the time zone named by TZID or in local time
+func parseICSTime(value string, params map[string]string) (time.Time, bool, error) {
+	value = strings.TrimSpace(value)
+	if params["VALUE"] == "DATE" || len(value) == 8 {
+		t, err := time.ParseInLocation("20060102", value, time.Local)
+		return t, true, err
+	}
+	if strings.HasSuffix(value, "Z") {
+		t, err := time.Parse(icsTimeLayout, value)
+		return t, false, err
+	}
+	location := time.Local
+	if tzid := params["TZID"]; tzid != "" {
+		// names the time zone database doesn't know, like those of Windows, fall back to local time
+		if loc, err := time.LoadLocation(tzid); err == nil {
+			location = loc
+		}
+	}
+	t, err := time.ParseInLocation("20060102T150405", value, location)
+	return t, false, err
+}
+
+// parseICSTimes parses the comma separated values of EXDATE and RDATE properties
+func parseICSTimes(properties []icsProperty) ([]time.Time, error) {
+	times := make([]time.Time, 0)
+	for _, property := range properties {
+		for _, value := range strings.Split(property.Value, ",") {
+			t, _, err := parseICSTime(value, property.Params)
+			if err != nil {
+				return nil, fmt.Errorf("invalid %s %q", property.Name, value)
+			}
+			times = append(times, t)
+		}
+	}
+	return times, nil
+}
+
+// parseICSDuration parses durations like PT1H30M, P1D or P2W
+func parseICSDuration(value string) (time.Duration, error) {
+	s := strings.TrimPrefix(value, "+")
+	sign := time.Duration(1)
+	if strings.HasPrefix(s, "-") {
+		sign, s = -1, s[1:]
+	}
+	if !strings.HasPrefix(s, "P") || len(s) < 3 {
+		return 0, fmt.Errorf("invalid duration %q", value)
+	}
+	units := map[byte]time.Duration{'W': 7 * 24 * time.Hour, 'D': 24 * time.Hour, 'H': time.Hour, 'M': time.Minute, 'S': time.Second}
+	var d time.Duration
+	number := ""
+	for _, c := range []byte(s[1:]) {
+		switch {
+		case c == 'T':
+		case c >= '0' && c <= '9':
+			number += string(c)
+		case units[c] != 0 && number != "":
+			n, _ := strconv.Atoi(number)
+			d += time.Duration(n) * units[c]
+			number = ""
+		default:
+			return 0, fmt.Errorf("invalid duration %q", value)
+		}
+	}
+	if number != "" {
+		return 0, fmt.Errorf("invalid duration %q", value)
+	}
+	return sign * d, nil
+}
+
+var icsWeekdays = map[string]time.Weekday{
+	"SU": time.Sunday, "MO": time.Monday, "TU": time.Tuesday, "WE": time.Wednesday,
+	"TH": time.Thursday, "FR": time.Friday, "SA": time.Saturday,
+}
+
+// icsByDay is an entry of BYDAY, e.g. MO, 1MO for the first monday or -1FR for the last friday
+type icsByDay struct {
+	Ordinal int
+	Weekday time.Weekday
+}
+
+// rrule is a recurrence rule, the parts it doesn't hold aren't supported
+type rrule struct {
+	Freq       string
+	Interval   int
+	Count      int
+	Until      time.Time
+	ByDay      []icsByDay
+	ByMonthDay []int
+	ByMonth    []int
+	WeekStart  time.Weekday
+}
+
+var ErrUnsupportedRRule = errors.New("unsupported recurrence rule")
+
+func parseRRule(value string) (*rrule, error) {
+	rule := &rrule{Interval: 1, WeekStart: time.Monday}
+	for _, part := range strings.Split(value, ";") {
+		key, val, _ := strings.Cut(part, "=")
+		var err error
+		switch strings.ToUpper(key) {
+		case "FREQ":
+			rule.Freq = strings.ToUpper(val)
+			switch rule.Freq {
+			case "DAILY", "WEEKLY", "MONTHLY", "YEARLY":
+			default:
+				return nil, fmt.Errorf("%w: FREQ=%s", ErrUnsupportedRRule, val)
+			}
+		case "INTERVAL":
+			rule.Interval, err = strconv.Atoi(val)
+			if err == nil && rule.Interval < 1 {
+				err = errors.New("the interval isn't positive")
+			}
+		case "COUNT":
+			rule.Count, err = strconv.Atoi(val)
+		case "UNTIL":
+			rule.Until, _, err = parseICSTime(val, nil)
+			if err == nil && len(val) == 8 {
+				// an UNTIL date includes the whole day
+				rule.Until = rule.Until.AddDate(0, 0, 1).Add(-time.Second)
+			}
+		case "WKST":
+			weekday, OK := icsWeekdays[strings.ToUpper(val)]
+			if !OK {
+				err = errors.New("invalid WKST")
+			}
+			rule.WeekStart = weekday
+		case "BYDAY":
+			for _, day := range strings.Split(strings.ToUpper(val), ",") {
+				if len(day) < 2 {
+					return nil, fmt.Errorf("invalid BYDAY %q", val)
+				}
+				weekday, OK := icsWeekdays[day[len(day)-2:]]
+				if !OK {
+					return nil, fmt.Errorf("invalid BYDAY %q", val)
+				}
+				ordinal := 0
+				if len(day) > 2 {
+					ordinal, err = strconv.Atoi(day[:len(day)-2])
+					if err != nil {
+						return nil, fmt.Errorf("invalid BYDAY %q", val)
+					}
+				}
+				rule.ByDay = append(rule.ByDay, icsByDay{Ordinal: ordinal, Weekday: weekday})
+			}
+		case "BYMONTHDAY", "BYMONTH":
+			for _, n := range strings.Split(val, ",") {
+				number, err := strconv.Atoi(n)
+				if err != nil || number == 0 {
+					return nil, fmt.Errorf("invalid %s %q", key, val)
+				}
+				if strings.ToUpper(key) == "BYMONTH" {
+					rule.ByMonth = append(rule.ByMonth, number)
+				} else {
+					rule.ByMonthDay = append(rule.ByMonthDay, number)
+				}
+			}
+		default:
+			return nil, fmt.Errorf("%w: %s", ErrUnsupportedRRule, key)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s %q: %v", key, val, err)
+		}
+	}
+	if rule.Freq == "" {
+		return nil, errors.New("the recurrence rule has no FREQ")
+	}
+	for _, day := range rule.ByDay {
+		// ordinals are counted within the month, yearly rules only support them along with BYMONTH
+		if day.Ordinal != 0 && (rule.Freq == "DAILY" || rule.Freq == "WEEKLY" || (rule.Freq == "YEARLY" && len(rule.ByMonth) == 0)) {
+			return nil, fmt.Errorf("%w: BYDAY=%d%s with FREQ=%s", ErrUnsupportedRRule, day.Ordinal, day.Weekday, rule.Freq)
+		}
+	}
+	return rule, nil
+}
+
+// matchesDay tells if the rule of an event starting at dtstart recurs on day
+func (rule *rrule) matchesDay(dtstart, day time.Time) bool {
+	months := (day.Year()-dtstart.Year())*12 + int(day.Month()) - int(dtstart.Month())
+	switch rule.Freq {
+	case "DAILY":
+		days := int(day.Sub(time.Date(dtstart.Year(), dtstart.Month(), dtstart.Day(), 0, 0, 0, 0, day.Location())).Hours()+12) / 24
+		if days%rule.Interval != 0 {
+			return false
+		}
+	case "WEEKLY":
+		first := startOfWeek(time.Date(dtstart.Year(), dtstart.Month(), dtstart.Day(), 0, 0, 0, 0, day.Location()), rule.WeekStart)
+		weeks := int(startOfWeek(day, rule.WeekStart).Sub(first).Hours()+12) / 24 / 7
+		if weeks%rule.Interval != 0 {
+			return false
+		}
+		if len(rule.ByDay) == 0 {
+			return day.Weekday() == dtstart.Weekday()
+		}
+	case "MONTHLY":
+		if months%rule.Interval != 0 {
+			return false
+		}
+	case "YEARLY":
+		if (day.Year()-dtstart.Year())%rule.Interval != 0 {
+			return false
+		}
+		if len(rule.ByMonth) == 0 && day.Month() != dtstart.Month() {
+			return false
+		}
+	}
+
+	if len(rule.ByMonth) > 0 && !containsInt(rule.ByMonth, int(day.Month())) {
+		return false
+	}
+	daysInMonth := time.Date(day.Year(), day.Month()+1, 0, 0, 0, 0, 0, day.Location()).Day()
+	if len(rule.ByMonthDay) > 0 {
+		matched := false
+		for _, n := range rule.ByMonthDay {
+			if n == day.Day() || (n < 0 && daysInMonth+n+1 == day.Day()) {
+				matched = true
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+	if len(rule.ByDay) > 0 {
+		matched := false
+		for _, byDay := range rule.ByDay {
+			if byDay.Weekday != day.Weekday() {
+				continue
+			}
+			nth, nthFromEnd := (day.Day()-1)/7+1, -((daysInMonth-day.Day())/7 + 1)
+			if byDay.Ordinal == 0 || byDay.Ordinal == nth || byDay.Ordinal == nthFromEnd {
+				matched = true
+			}
+		}
+		return matched
+	}
+	// monthly and yearly rules without BYDAY nor BYMONTHDAY recur on the day of the month they start on
+	if len(rule.ByMonthDay) == 0 && (rule.Freq == "MONTHLY" || rule.Freq == "YEARLY") {
+		return day.Day() == dtstart.Day()
+	}
+	return true
+}
+
+func containsInt(numbers []int, n int) bool {
+	for _, number := range numbers {
+		if number == n {
+			return true
+		}
+	}
+	return false
+}
+
+// occurrences returns the starts of the occurrences of the rule up to end, dtstart being the first
+func (rule *rrule) occurrences(dtstart, end time.Time) []time.Time {
+	starts := make([]time.Time, 0)
+	for i := 0; ; i++ {
+		day := time.Date(dtstart.Year(), dtstart.Month(), dtstart.Day()+i, dtstart.Hour(), dtstart.Minute(), dtstart.Second(), 0, dtstart.Location())
+		if day.After(end) || (!rule.Until.IsZero() && day.After(rule.Until)) {
+			break
+		}
+		if i > 0 && !rule.matchesDay(dtstart, day) {
+			continue
+		}
+		starts = append(starts, day)
+		if rule.Count > 0 && len(starts) == rule.Count {
+			break
+		}
+	}
+	return starts
+}
+
+// readICS reads the events of a calendar starting between from and to (inclusive) as sessions of activity,
+// recurring events are expanded, minus their exceptions, and moved occurrences replace the original ones.
+// Events without a time, cancelled, not over yet or using unsupported recurrence rules are skipped
+func readICS(filename, activity string, from, to time.Time) ([]importRecord, []string, []string, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	defer f.Close()
+
+	events, err := readICSEvents(f)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("invalid calendar %s: %v", filename, err)
+	}
+
+	records := make([]importRecord, 0)
+	invalid := make([]string, 0)
+	skipped := make([]string, 0)
+	// occurrences moved or cancelled by an event with a RECURRENCE-ID
+	overridden := make(map[string]bool)
+	type occurrence struct {
+		event      icsEvent
+		uid        string
+		start, end time.Time
+		original   time.Time
+	}
+	occurrences := make([]occurrence, 0)
+	masters := make([]icsEvent, 0)
+	now := time.Now()
+
+	for _, event := range events {
+		uidProperty, _ := event.get("UID")
+		uid := strings.TrimSpace(uidProperty.Value)
+		if uid == "" {
+			invalid = append(invalid, fmt.Sprintf("row %d: the event has no UID", event.Row))
+			continue
+		}
+		recurrenceID, OK := event.get("RECURRENCE-ID")
+		if !OK {
+			masters = append(masters, event)
+			continue
+		}
+		original, _, err := parseICSTime(recurrenceID.Value, recurrenceID.Params)
+		if err != nil {
+			invalid = append(invalid, fmt.Sprintf("row %d: invalid RECURRENCE-ID %q", event.Row, recurrenceID.Value))
+			continue
+		}
+		overridden[fmt.Sprintf("%s/%d", uid, original.Unix())] = true
+		occurrences = append(occurrences, occurrence{event: event, uid: uid, original: original})
+	}
+
+	for _, event := range masters {
+		uidProperty, _ := event.get("UID")
+		uid := strings.TrimSpace(uidProperty.Value)
+		rruleProperty, recurring := event.get("RRULE")
+		_, hasRDate := event.get("RDATE")
+		if !recurring && !hasRDate {
+			occurrences = append(occurrences, occurrence{event: event, uid: uid})
+			continue
+		}
+
+		dtstartProperty, _ := event.get("DTSTART")
+		dtstart, _, err := parseICSTime(dtstartProperty.Value, dtstartProperty.Params)
+		if err != nil {
+			invalid = append(invalid, fmt.Sprintf("row %d: invalid DTSTART %q", event.Row, dtstartProperty.Value))
+			continue
+		}
+		starts := []time.Time{dtstart}
+		if recurring {
+			rule, err := parseRRule(rruleProperty.Value)
+			if errors.Is(err, ErrUnsupportedRRule) {
+				skipped = append(skipped, fmt.Sprintf("row %d: %v", event.Row, err))
+				continue
+			}
+			if err != nil {
+				invalid = append(invalid, fmt.Sprintf("row %d: %v", event.Row, err))
+				continue
+			}
+			starts = rule.occurrences(dtstart, to.AddDate(0, 0, 1))
+		}
+		rdates, err := parseICSTimes(event.Properties["RDATE"])
+		if err != nil {
+			invalid = append(invalid, fmt.Sprintf("row %d: %v", event.Row, err))
+			continue
+		}
+		exdates, err := parseICSTimes(event.Properties["EXDATE"])
+		if err != nil {
+			invalid = append(invalid, fmt.Sprintf("row %d: %v", event.Row, err))
+			continue
+		}
+		excluded := make(map[int64]bool)
+		for _, exdate := range exdates {
+			excluded[exdate.Unix()] = true
+		}
+		for _, start := range append(starts, rdates...) {
+			if excluded[start.Unix()] || overridden[fmt.Sprintf("%s/%d", uid, start.Unix())] {
+				continue
+			}
+			occurrences = append(occurrences, occurrence{event: event, uid: uid, start: start, original: start})
+		}
+	}
+
+	for _, o := range occurrences {
+		event := o.event
+		if status, _ := event.get("STATUS"); strings.EqualFold(status.Value, "CANCELLED") {
+			continue
+		}
+		dtstartProperty, OK := event.get("DTSTART")
+		if !OK {
+			invalid = append(invalid, fmt.Sprintf("row %d: the event has no DTSTART", event.Row))
+			continue
+		}
+		dtstart, allDay, err := parseICSTime(dtstartProperty.Value, dtstartProperty.Params)
+		if err != nil {
+			invalid = append(invalid, fmt.Sprintf("row %d: invalid DTSTART %q", event.Row, dtstartProperty.Value))
+			continue
+		}
+		if allDay {
+			skipped = append(skipped, fmt.Sprintf("row %d: all day events aren't sessions", event.Row))
+			continue
+		}
+
+		var duration time.Duration
+		if dtend, OK := event.get("DTEND"); OK {
+			end, _, err := parseICSTime(dtend.Value, dtend.Params)
+			if err != nil {
+				invalid = append(invalid, fmt.Sprintf("row %d: invalid DTEND %q", event.Row, dtend.Value))
+				continue
+			}
+			duration = end.Sub(dtstart)
+		} else if durationProperty, OK := event.get("DURATION"); OK {
+			duration, err = parseICSDuration(durationProperty.Value)
+			if err != nil {
+				invalid = append(invalid, fmt.Sprintf("row %d: %v", event.Row, err))
+				continue
+			}
+		}
+
+		start := dtstart
+		if !o.start.IsZero() {
+			start = o.start
+		}
+		original := o.original
+		if original.IsZero() {
+			original = start
+		}
+		end := start.Add(duration)
+		if start.Before(from) || !start.Before(to.AddDate(0, 0, 1)) {
+			continue
+		}
+		if end.After(now) {
+			skipped = append(skipped, fmt.Sprintf("row %d: the event on %s isn't over yet", event.Row, start.Local().Format("2006-01-02 15:04")))
+			continue
+		}
+
+		summary, _ := event.get("SUMMARY")
+		records = append(records, importRecord{
+			Row:         event.Row,
+			Activity:    activity,
+			Start:       start.Local(),
+			End:         end.Local(),
+			Description: icsUnescape(summary.Value),
+			UID:         o.uid,
+			Occurrence:  original,
+		})
+	}
+	sort.SliceStable(records, func(i, j int) bool { return records[i].Start.Before(records[j].Start) })
+	return records, invalid, skipped, nil
+}
@@ -0,0 +1,236 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseRRule(t *testing.T) {
+	cases := []struct {
+		value       string
+		want        rrule
+		unsupported bool
+		fails       bool
+	}{
+		{value: "FREQ=WEEKLY;INTERVAL=2;BYDAY=TU,TH", want: rrule{Freq: "WEEKLY", Interval: 2, WeekStart: time.Monday,
+			ByDay: []icsByDay{{0, time.Tuesday}, {0, time.Thursday}}}},
+		{value: "FREQ=MONTHLY;BYDAY=-1FR;COUNT=4", want: rrule{Freq: "MONTHLY", Interval: 1, Count: 4, WeekStart: time.Monday,
+			ByDay: []icsByDay{{-1, time.Friday}}}},
+		{value: "freq=monthly;bymonthday=31,-1;wkst=su", want: rrule{Freq: "MONTHLY", Interval: 1, WeekStart: time.Sunday,
+			ByMonthDay: []int{31, -1}}},
+		{value: "FREQ=YEARLY;BYMONTH=3;BYDAY=2SU", want: rrule{Freq: "YEARLY", Interval: 1, WeekStart: time.Monday,
+			ByMonth: []int{3}, ByDay: []icsByDay{{2, time.Sunday}}}},
+		// an UNTIL date includes the whole day
+		{value: "FREQ=DAILY;UNTIL=20260108", want: rrule{Freq: "DAILY", Interval: 1, WeekStart: time.Monday,
+			Until: time.Date(2026, time.January, 8, 23, 59, 59, 0, time.Local)}},
+		{value: "FREQ=DAILY;UNTIL=20260108T170000Z", want: rrule{Freq: "DAILY", Interval: 1, WeekStart: time.Monday,
+			Until: time.Date(2026, time.January, 8, 17, 0, 0, 0, time.UTC)}},
+
+		{value: "FREQ=HOURLY", unsupported: true},
+		{value: "FREQ=MONTHLY;BYSETPOS=-1;BYDAY=MO,TU,WE,TH,FR", unsupported: true},
+		{value: "FREQ=WEEKLY;BYDAY=1MO", unsupported: true},
+		{value: "FREQ=YEARLY;BYDAY=20MO", unsupported: true},
+		{value: "COUNT=3", fails: true},
+		{value: "FREQ=DAILY;INTERVAL=0", fails: true},
+		{value: "FREQ=WEEKLY;BYDAY=XX", fails: true},
+		{value: "FREQ=MONTHLY;BYMONTHDAY=0", fails: true},
+		{value: "FREQ=DAILY;UNTIL=tomorrow", fails: true},
+	}
+	for _, c := range cases {
+		rule, err := parseRRule(c.value)
+		switch {
+		case c.unsupported:
+			if !errors.Is(err, ErrUnsupportedRRule) {
+				t.Errorf("%s returned %v, want %v", c.value, err, ErrUnsupportedRRule)
+			}
+		case c.fails:
+			if err == nil || errors.Is(err, ErrUnsupportedRRule) {
+				t.Errorf("%s returned %v, want an invalid rule", c.value, err)
+			}
+		case err != nil:
+			t.Errorf("%s returned %v", c.value, err)
+		default:
+			if !rule.Until.Equal(c.want.Until) {
+				t.Errorf("%s ends on %v, want %v", c.value, rule.Until, c.want.Until)
+			}
+			rule.Until, c.want.Until = time.Time{}, time.Time{}
+			if rule.Freq != c.want.Freq || rule.Interval != c.want.Interval || rule.Count != c.want.Count ||
+				rule.WeekStart != c.want.WeekStart || !slices.Equal(rule.ByDay, c.want.ByDay) ||
+				!slices.Equal(rule.ByMonthDay, c.want.ByMonthDay) || !slices.Equal(rule.ByMonth, c.want.ByMonth) {
+				t.Errorf("%s parsed to %+v, want %+v", c.value, *rule, c.want)
+			}
+		}
+	}
+}
+
+func TestRRuleOccurrences(t *testing.T) {
+	paris, err := time.LoadLocation("Europe/Paris")
+	if err != nil {
+		t.Skip("the time zone database isn't available")
+	}
+	cases := []struct {
+		name    string
+		dtstart time.Time
+		rule    string
+		end     time.Time
+		want    []string
+	}{
+		{"every other tuesday and thursday",
+			time.Date(2026, time.January, 6, 9, 0, 0, 0, time.Local), "FREQ=WEEKLY;INTERVAL=2;BYDAY=TU,TH;COUNT=4", time.Date(2026, time.December, 31, 0, 0, 0, 0, time.Local),
+			[]string{"2026-01-06 09:00", "2026-01-08 09:00", "2026-01-20 09:00", "2026-01-22 09:00"}},
+		{"weekly on the day of dtstart",
+			time.Date(2026, time.January, 7, 18, 30, 0, 0, time.Local), "FREQ=WEEKLY", time.Date(2026, time.January, 28, 0, 0, 0, 0, time.Local),
+			[]string{"2026-01-07 18:30", "2026-01-14 18:30", "2026-01-21 18:30"}},
+		// months without a 31st are skipped rather than moved to their last day
+		{"on the 31st",
+			time.Date(2026, time.January, 31, 10, 0, 0, 0, time.Local), "FREQ=MONTHLY;BYMONTHDAY=31", time.Date(2026, time.June, 30, 0, 0, 0, 0, time.Local),
+			[]string{"2026-01-31 10:00", "2026-03-31 10:00", "2026-05-31 10:00"}},
+		{"on the last day of the month",
+			time.Date(2026, time.January, 31, 10, 0, 0, 0, time.Local), "FREQ=MONTHLY;BYMONTHDAY=-1;COUNT=3", time.Date(2026, time.December, 31, 0, 0, 0, 0, time.Local),
+			[]string{"2026-01-31 10:00", "2026-02-28 10:00", "2026-03-31 10:00"}},
+		{"on the last friday of the month",
+			time.Date(2026, time.January, 30, 17, 0, 0, 0, time.Local), "FREQ=MONTHLY;BYDAY=-1FR;COUNT=4", time.Date(2026, time.December, 31, 0, 0, 0, 0, time.Local),
+			[]string{"2026-01-30 17:00", "2026-02-27 17:00", "2026-03-27 17:00", "2026-04-24 17:00"}},
+		{"until a date, which is included",
+			time.Date(2026, time.January, 5, 18, 0, 0, 0, time.Local), "FREQ=DAILY;UNTIL=20260108", time.Date(2026, time.December, 31, 0, 0, 0, 0, time.Local),
+			[]string{"2026-01-05 18:00", "2026-01-06 18:00", "2026-01-07 18:00", "2026-01-08 18:00"}},
+		// the wall clock time is kept across daylight saving time
+		{"across a daylight saving time change",
+			time.Date(2026, time.March, 28, 9, 0, 0, 0, paris), "FREQ=DAILY;COUNT=3", time.Date(2026, time.December, 31, 0, 0, 0, 0, paris),
+			[]string{"2026-03-28 09:00", "2026-03-29 09:00", "2026-03-30 09:00"}},
+		{"up to the end of the import",
+			time.Date(2026, time.January, 5, 8, 0, 0, 0, time.Local), "FREQ=DAILY;INTERVAL=3", time.Date(2026, time.January, 12, 0, 0, 0, 0, time.Local),
+			[]string{"2026-01-05 08:00", "2026-01-08 08:00", "2026-01-11 08:00"}},
+	}
+	for _, c := range cases {
+		rule, err := parseRRule(c.rule)
+		if err != nil {
+			t.Fatalf("%s: %v", c.name, err)
+		}
+		got := make([]string, 0)
+		for _, start := range rule.occurrences(c.dtstart, c.end) {
+			got = append(got, start.Format("2006-01-02 15:04"))
+		}
+		if !slices.Equal(got, c.want) {
+			t.Errorf("%s: got %v, want %v", c.name, got, c.want)
+		}
+	}
+}
+
+// a weekly meeting whose second occurrence is cancelled and third one moved to the next day,
+// with a summary folded over two lines
+const testCalendar = `BEGIN:VCALENDAR
+VERSION:2.0
+BEGIN:VEVENT
+UID:weekly@example.com
+DTSTART;TZID=Europe/Paris:20250106T090000
+DTEND;TZID=Europe/Paris:20250106T100000
+RRULE:FREQ=WEEKLY;BYDAY=MO;COUNT=4
+EXDATE;TZID=Europe/Paris:20250113T090000
+SUMMARY:Weekly
+  sync
+BEGIN:VALARM
+TRIGGER:-PT10M
+END:VALARM
+END:VEVENT
+BEGIN:VEVENT
+UID:weekly@example.com
+RECURRENCE-ID;TZID=Europe/Paris:20250120T090000
+DTSTART;TZID=Europe/Paris:%s
+DTEND;TZID=Europe/Paris:%s
+SUMMARY:Weekly sync, moved
+END:VEVENT
+BEGIN:VEVENT
+UID:cancelled@example.com
+DTSTART:20250110T080000Z
+DTEND:20250110T090000Z
+STATUS:CANCELLED
+END:VEVENT
+END:VCALENDAR
+`
+
+// writeTestCalendar writes testCalendar with the moved occurrence starting and ending at the given times
+func writeTestCalendar(t *testing.T, movedStart, movedEnd string) string {
+	t.Helper()
+	calendar := strings.Replace(strings.Replace(testCalendar, "%s", movedStart, 1), "%s", movedEnd, 1)
+	filename := filepath.Join(t.TempDir(), "calendar.ics")
+	err := os.WriteFile(filename, []byte(strings.ReplaceAll(calendar, "\n", "\r\n")), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return filename
+}
+
+func TestReadICSExpandsRecurringEvents(t *testing.T) {
+	paris, err := time.LoadLocation("Europe/Paris")
+	if err != nil {
+		t.Skip("the time zone database isn't available")
+	}
+	filename := writeTestCalendar(t, "20250121T140000", "20250121T150000")
+	from := time.Date(2025, time.January, 1, 0, 0, 0, 0, time.Local)
+	to := time.Date(2025, time.March, 31, 0, 0, 0, 0, time.Local)
+	records, invalid, skipped, err := readICS(filename, "meetings", from, to)
+	if err != nil || len(invalid) > 0 || len(skipped) > 0 {
+		t.Fatalf("reading the calendar returned %v, invalid %v and skipped %v", err, invalid, skipped)
+	}
+
+	// COUNT includes the excluded occurrence, so the series ends on the 27th
+	want := []struct {
+		start, occurrence time.Time
+		description       string
+	}{
+		{time.Date(2025, time.January, 6, 9, 0, 0, 0, paris), time.Date(2025, time.January, 6, 9, 0, 0, 0, paris), "Weekly sync"},
+		{time.Date(2025, time.January, 21, 14, 0, 0, 0, paris), time.Date(2025, time.January, 20, 9, 0, 0, 0, paris), "Weekly sync, moved"},
+		{time.Date(2025, time.January, 27, 9, 0, 0, 0, paris), time.Date(2025, time.January, 27, 9, 0, 0, 0, paris), "Weekly sync"},
+	}
+	if len(records) != len(want) {
+		t.Fatalf("got %d records, want %d: %v", len(records), len(want), records)
+	}
+	for i, w := range want {
+		record := records[i]
+		if !record.Start.Equal(w.start) || !record.End.Equal(w.start.Add(time.Hour)) || !record.Occurrence.Equal(w.occurrence) ||
+			record.UID != "weekly@example.com" || record.Description != w.description || record.Activity != "meetings" {
+			t.Errorf("record %d is %+v, want a session at %v for the occurrence of %v named %q", i, record, w.start, w.occurrence, w.description)
+		}
+	}
+}
+
+func TestImportICSOnceByOccurrence(t *testing.T) {
+	useTestDB(t)
+	from := time.Date(2025, time.January, 1, 0, 0, 0, 0, time.Local)
+	to := time.Date(2025, time.March, 31, 0, 0, 0, 0, time.Local)
+	importCalendar := func(filename string) *ImportReport {
+		t.Helper()
+		records, invalid, _, err := readICS(filename, "meetings", from, to)
+		if err != nil {
+			t.Fatal(err)
+		}
+		records, unresolved := prepareRecords(records, &activityMapping{})
+		report, err := importSessions(records, append(invalid, unresolved...), false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return report
+	}
+
+	report := importCalendar(writeTestCalendar(t, "20250121T140000", "20250121T150000"))
+	if len(report.Added) != 3 {
+		t.Fatalf("the first import added %d sessions, want 3", len(report.Added))
+	}
+	before := dumpSessions(t)
+
+	// the moved occurrence is moved again, it is still the occurrence of the 20th that was imported
+	report = importCalendar(writeTestCalendar(t, "20250122T160000", "20250122T170000"))
+	if len(report.Added) != 0 || len(report.Duplicates) != 3 {
+		t.Fatalf("importing the calendar again added %d sessions and found %d duplicates, want 0 and 3",
+			len(report.Added), len(report.Duplicates))
+	}
+	if after := dumpSessions(t); after != before {
+		t.Errorf("importing the calendar again changed the sessions from\n%s\nto\n%s", before, after)
+	}
+}
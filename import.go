@@ -0,0 +1,492 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// fields a session is built from, matched case-insensitively against the column names of the file
+// unless mapped to another column. start and end may be times of day when a date column is present.
+// project, tags and description are used to pick the activity of rows without one, see activityMapping
+var importFields = []string{"activity", "start", "end", "minutes", "date", "start_date", "end_date", "project", "tags", "description"}
+
+// layouts tried, in order, when detecting the format of a timestamp column, day first
+// layouts come after their month first counterparts so that ambiguous dates are read as mm/dd
+var timestampLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+	"2006-01-02T15:04",
+	"2006-01-02 15:04",
+	"2006/01/02 15:04:05",
+	"2006/01/02 15:04",
+	"01/02/2006 15:04:05",
+	"01/02/2006 15:04",
+	"01/02/2006 03:04:05 PM",
+	"01/02/2006 03:04 PM",
+	"02/01/2006 15:04:05",
+	"02/01/2006 15:04",
+	"02.01.2006 15:04:05",
+	"02.01.2006 15:04",
+}
+
+var dateLayouts = []string{"2006-01-02", "2006/01/02", "01/02/2006", "02/01/2006", "02.01.2006"}
+
+var timeOfDayLayouts = []string{"15:04:05", "15:04", "03:04:05 PM", "03:04 PM", "3:04:05 PM", "3:04 PM"}
+
+// importRecord is a session read from an import file, Row being its position in the file for reporting
+type importRecord struct {
+	Row      int
+	Activity string
+	Start    time.Time
+	End      time.Time
+	// what other trackers call the session, used to pick its activity
+	Project     string
+	Tags        []string
+	Description string
+	// calendar event the session comes from, remembered so that the event is imported once
+	UID        string
+	Occurrence time.Time
+}
+
+func (r importRecord) String() string {
+	return fmt.Sprintf("row %d: %s from %s to %s", r.Row, r.Activity, r.Start.Format("2006-01-02 15:04"), r.End.Format("2006-01-02 15:04"))
+}
+
+type ImportReport struct {
+	Added      []importRecord
+	Duplicates []importRecord
+	// sessions overlapping an existing session or one added earlier by the same import
+	Overlaps []importRecord
+	Invalid  []string
+	// entries of the file that can't become sessions but don't make the file invalid, e.g. running timers
+	Skipped []string
+}
+
+var ErrInvalidImport = errors.New("the file has invalid rows, nothing was imported")
+
+// readTable reads a csv file, a json array of objects or json lines into a header and rows of strings
+func readTable(r io.Reader, filename string) ([]string, [][]string, error) {
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".csv":
+		cr := csv.NewReader(r)
+		cr.FieldsPerRecord = -1
+		records, err := cr.ReadAll()
+		if err != nil {
+			return nil, nil, err
+		}
+		if len(records) == 0 {
+			return nil, nil, fmt.Errorf("%s is empty", filename)
+		}
+		return records[0], records[1:], nil
+	case ".json", ".jsonl", ".ndjson":
+		return readJSONTable(r)
+	default:
+		return nil, nil, fmt.Errorf("unsupported file %s, expected a .csv, .json or .jsonl file", filename)
+	}
+}
+
+// readJSONTable accepts both an array of objects and one object per line
+func readJSONTable(r io.Reader) ([]string, [][]string, error) {
+	dec := json.NewDecoder(r)
+	dec.UseNumber()
+
+	objects := make([]map[string]any, 0)
+	token, err := dec.Token()
+	if err != nil {
+		return nil, nil, err
+	}
+	if token == json.Delim('[') {
+		for dec.More() {
+			var object map[string]any
+			err = dec.Decode(&object)
+			if err != nil {
+				return nil, nil, err
+			}
+			objects = append(objects, object)
+		}
+	} else if token == json.Delim('{') {
+		// json lines, the opening brace of the first object was consumed by Token
+		first, err := decodeObjectBody(dec)
+		if err != nil {
+			return nil, nil, err
+		}
+		objects = append(objects, first)
+		for dec.More() {
+			var object map[string]any
+			err = dec.Decode(&object)
+			if err != nil {
+				return nil, nil, err
+			}
+			objects = append(objects, object)
+		}
+	} else {
+		return nil, nil, fmt.Errorf("expected an array of objects or one object per line")
+	}
+
+	header := make([]string, 0)
+	seen := make(map[string]bool)
+	for _, object := range objects {
+		for key := range object {
+			if !seen[key] {
+				seen[key] = true
+				header = append(header, key)
+			}
+		}
+	}
+	sort.Strings(header)
+	rows := make([][]string, len(objects))
+	for i, object := range objects {
+		rows[i] = make([]string, len(header))
+		for j, key := range header {
+			if v, OK := object[key]; OK && v != nil {
+				rows[i][j] = fmt.Sprint(v)
+			}
+		}
+	}
+	return header, rows, nil
+}
+
+// decodeObjectBody decodes the keys and values of an object whose opening brace was already read
+func decodeObjectBody(dec *json.Decoder) (map[string]any, error) {
+	object := make(map[string]any)
+	for dec.More() {
+		token, err := dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		key, OK := token.(string)
+		if !OK {
+			return nil, fmt.Errorf("invalid object key %v", token)
+		}
+		var value any
+		err = dec.Decode(&value)
+		if err != nil {
+			return nil, err
+		}
+		object[key] = value
+	}
+	_, err := dec.Token()
+	return object, err
+}
+
+// parseColumnMapping parses field=column pairs overriding the column a field is read from
+func parseColumnMapping(pairs []string) (map[string]string, error) {
+	mapping := make(map[string]string)
+	for _, pair := range pairs {
+		field, column, OK := strings.Cut(pair, "=")
+		field = strings.ToLower(strings.TrimSpace(field))
+		if !OK || !contains(importFields, field) {
+			return nil, fmt.Errorf("invalid column mapping %q, expected <field>=<column> with field one of %s", pair, strings.Join(importFields, ", "))
+		}
+		mapping[field] = strings.TrimSpace(column)
+	}
+	return mapping, nil
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// detectLayout returns the layout parsing the most non-empty values, the earliest one on ties.
+// Values the layout can't parse are reported as invalid rows later on
+func detectLayout(values []string, layouts []string) (string, bool) {
+	best, bestMatches := "", 0
+	for _, layout := range layouts {
+		matches := 0
+		for _, value := range values {
+			if value == "" {
+				continue
+			}
+			if _, err := time.ParseInLocation(layout, value, time.Local); err == nil {
+				matches++
+			}
+		}
+		if matches > bestMatches {
+			best, bestMatches = layout, matches
+		}
+	}
+	return best, bestMatches > 0
+}
+
+// isUnixTimestamps reports whether most non-empty values are unix timestamps in seconds or milliseconds
+func isUnixTimestamps(values []string) bool {
+	numbers, others := 0, 0
+	for _, value := range values {
+		if value == "" {
+			continue
+		}
+		if _, err := strconv.ParseInt(value, 10, 64); err != nil {
+			others++
+		} else {
+			numbers++
+		}
+	}
+	return numbers > others
+}
+
+func parseUnixTimestamp(value string) time.Time {
+	v, _ := strconv.ParseInt(value, 10, 64)
+	if v > 1e11 {
+		return time.UnixMilli(v)
+	}
+	return time.Unix(v, 0)
+}
+
+// tableColumn resolves the values of a field, using the mapped column or the column named after the field
+type tableColumn struct {
+	index  int
+	layout string
+	unix   bool
+}
+
+// parseTable converts the rows of an import file into sessions. Rows that can't be
+// converted are returned as messages instead of aborting, so they can all be reported at once
+func parseTable(header []string, rows [][]string, mapping map[string]string, timeFormat string) ([]importRecord, []string, error) {
+	columns := make(map[string]*tableColumn)
+	for _, field := range importFields {
+		name := field
+		if mapped, OK := mapping[field]; OK {
+			name = mapped
+		}
+		for i, column := range header {
+			if strings.EqualFold(strings.TrimSpace(column), name) {
+				columns[field] = &tableColumn{index: i}
+				break
+			}
+		}
+		if _, OK := columns[field]; !OK && mapping[field] != "" {
+			return nil, nil, fmt.Errorf("column %q mapped to %s doesn't exist", mapping[field], field)
+		}
+	}
+	hasActivity := columns["activity"] != nil || columns["project"] != nil || columns["tags"] != nil || columns["description"] != nil
+	if !hasActivity || columns["start"] == nil || (columns["end"] == nil && columns["minutes"] == nil) {
+		return nil, nil, fmt.Errorf("an activity, a start and an end or minutes column are required, found columns %s", strings.Join(header, ", "))
+	}
+
+	value := func(row []string, field string) string {
+		column := columns[field]
+		if column == nil || column.index >= len(row) {
+			return ""
+		}
+		return strings.TrimSpace(row[column.index])
+	}
+	values := func(field string) []string {
+		vs := make([]string, len(rows))
+		for i, row := range rows {
+			vs[i] = value(row, field)
+		}
+		return vs
+	}
+
+	// dates are detected first, start and end are then either full timestamps or times of day
+	for _, field := range []string{"date", "start_date", "end_date"} {
+		if columns[field] == nil {
+			continue
+		}
+		layout, OK := detectLayout(values(field), dateLayouts)
+		if !OK {
+			return nil, nil, fmt.Errorf("couldn't detect the date format of the %s column", field)
+		}
+		columns[field].layout = layout
+	}
+	for _, field := range []string{"start", "end"} {
+		if columns[field] == nil {
+			continue
+		}
+		vs := values(field)
+		switch {
+		case timeFormat != "":
+			columns[field].layout = timeFormat
+		case isUnixTimestamps(vs):
+			columns[field].unix = true
+		default:
+			layout, OK := detectLayout(vs, timestampLayouts)
+			if dateColumn(columns, field) != nil {
+				if todLayout, todOK := detectLayout(vs, timeOfDayLayouts); todOK && !OK {
+					layout, OK = todLayout, todOK
+				}
+			}
+			if !OK {
+				return nil, nil, fmt.Errorf("couldn't detect the time format of the %s column, use --time-format", field)
+			}
+			columns[field].layout = layout
+		}
+	}
+
+	parseTime := func(row []string, field string) (time.Time, error) {
+		v := value(row, field)
+		column := columns[field]
+		if v == "" {
+			return time.Time{}, fmt.Errorf("%s is empty", field)
+		}
+		if column.unix {
+			if _, err := strconv.ParseInt(v, 10, 64); err != nil {
+				return time.Time{}, fmt.Errorf("invalid %s %q", field, v)
+			}
+			return parseUnixTimestamp(v), nil
+		}
+		if contains(timeOfDayLayouts, column.layout) {
+			dateField := dateColumn(columns, field)
+			d, err := time.ParseInLocation(dateField.layout, strings.TrimSpace(row[dateField.index]), time.Local)
+			if err != nil {
+				return time.Time{}, fmt.Errorf("invalid date for %s", field)
+			}
+			t, err := time.ParseInLocation(column.layout, v, time.Local)
+			if err != nil {
+				return time.Time{}, fmt.Errorf("invalid %s %q", field, v)
+			}
+			return time.Date(d.Year(), d.Month(), d.Day(), t.Hour(), t.Minute(), t.Second(), 0, time.Local), nil
+		}
+		t, err := time.ParseInLocation(column.layout, v, time.Local)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("invalid %s %q", field, v)
+		}
+		return t, nil
+	}
+
+	records := make([]importRecord, 0, len(rows))
+	invalid := make([]string, 0)
+	for i, row := range rows {
+		number := i + 1
+		record := importRecord{
+			Row:         number,
+			Activity:    value(row, "activity"),
+			Project:     value(row, "project"),
+			Tags:        splitTags(value(row, "tags")),
+			Description: value(row, "description"),
+		}
+		var err error
+		record.Start, err = parseTime(row, "start")
+		if err != nil {
+			invalid = append(invalid, fmt.Sprintf("row %d: %v", number, err))
+			continue
+		}
+		if columns["end"] != nil && value(row, "end") != "" {
+			record.End, err = parseTime(row, "end")
+			if err != nil {
+				invalid = append(invalid, fmt.Sprintf("row %d: %v", number, err))
+				continue
+			}
+			// a time of day earlier than the start without its own date ends after midnight
+			if record.End.Before(record.Start) && contains(timeOfDayLayouts, columns["end"].layout) && columns["end_date"] == nil {
+				record.End = record.End.AddDate(0, 0, 1)
+			}
+		} else {
+			minutes, err := strconv.ParseFloat(value(row, "minutes"), 64)
+			if err != nil {
+				invalid = append(invalid, fmt.Sprintf("row %d: neither an end nor minutes", number))
+				continue
+			}
+			record.End = record.Start.Add(time.Duration(minutes * float64(time.Minute)))
+		}
+		records = append(records, record)
+	}
+	return records, invalid, nil
+}
+
+// splitTags splits a comma separated list of tags
+func splitTags(s string) []string {
+	tags := make([]string, 0)
+	for _, tag := range strings.Split(s, ",") {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
+// dateColumn returns the column holding the date of the start or end field, if any
+func dateColumn(columns map[string]*tableColumn, field string) *tableColumn {
+	if column := columns[field+"_date"]; column != nil {
+		return column
+	}
+	return columns["date"]
+}
+
+// importSessions adds the records as closed sessions in a single transaction. Records already
+// in the database are skipped as duplicates, records overlapping an existing session are skipped
+// as overlaps. Nothing is written when dryRun is set or when invalid rows were found
+func importSessions(records []importRecord, invalid []string, dryRun bool) (*ImportReport, error) {
+	report := &ImportReport{Invalid: invalid}
+	sort.SliceStable(records, func(i, j int) bool { return records[i].Start.Before(records[j].Start) })
+
+	db, err := getDBConnection()
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	for _, record := range records {
+		var count int
+		if record.UID != "" {
+			err = tx.QueryRow(count_imported_events, record.UID, record.Occurrence.Unix()).Scan(&count)
+			if err != nil {
+				return nil, err
+			}
+			if count > 0 {
+				report.Duplicates = append(report.Duplicates, record)
+				continue
+			}
+		}
+		err = tx.QueryRow(count_duplicate_sessions, record.Activity, record.Start.Unix(), record.End.Unix()).Scan(&count)
+		if err != nil {
+			return nil, err
+		}
+		if count > 0 {
+			report.Duplicates = append(report.Duplicates, record)
+			continue
+		}
+		err = tx.QueryRow(count_overlapping_sessions, record.End.Unix(), record.Start.Unix()).Scan(&count)
+		if err != nil {
+			return nil, err
+		}
+		if count > 0 {
+			report.Overlaps = append(report.Overlaps, record)
+			continue
+		}
+		// later records of the same import are checked against this one
+		result, err := tx.Exec(insert_session, record.Start.Format("2006-01-02"), record.Activity, record.Start.Unix(), record.End.Unix())
+		if err != nil {
+			return nil, err
+		}
+		if record.UID != "" {
+			id, err := result.LastInsertId()
+			if err != nil {
+				return nil, err
+			}
+			_, err = tx.Exec(insert_imported_event, record.UID, record.Occurrence.Unix(), id)
+			if err != nil {
+				return nil, err
+			}
+		}
+		report.Added = append(report.Added, record)
+	}
+
+	if len(report.Invalid) > 0 {
+		return report, ErrInvalidImport
+	}
+	if dryRun {
+		return report, nil
+	}
+	return report, tx.Commit()
+}
@@ -0,0 +1,373 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// activityMapping picks the activity of sessions imported from other trackers. The project is looked up
+// first, then every tag and then the description, all case-insensitively. Sessions matching nothing
+// get Default, or when it's empty their project, first tag or description as is
+type activityMapping struct {
+	Projects     map[string]string `json:"projects"`
+	Tags         map[string]string `json:"tags"`
+	Descriptions map[string]string `json:"descriptions"`
+	Default      string            `json:"default"`
+}
+
+func loadActivityMapping(filename string) (*activityMapping, error) {
+	mapping := &activityMapping{}
+	if filename == "" {
+		return mapping, nil
+	}
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	err = json.Unmarshal(data, mapping)
+	if err != nil {
+		return nil, fmt.Errorf("invalid mapping file %s: %v", filename, err)
+	}
+	lower := func(m map[string]string) map[string]string {
+		lowered := make(map[string]string, len(m))
+		for k, v := range m {
+			lowered[strings.ToLower(strings.TrimSpace(k))] = v
+		}
+		return lowered
+	}
+	mapping.Projects = lower(mapping.Projects)
+	mapping.Tags = lower(mapping.Tags)
+	mapping.Descriptions = lower(mapping.Descriptions)
+	return mapping, nil
+}
+
+func (m *activityMapping) activity(record importRecord) string {
+	if record.Activity != "" {
+		return record.Activity
+	}
+	if activity, OK := m.Projects[strings.ToLower(record.Project)]; OK && record.Project != "" {
+		return activity
+	}
+	for _, tag := range record.Tags {
+		if activity, OK := m.Tags[strings.ToLower(tag)]; OK {
+			return activity
+		}
+	}
+	if activity, OK := m.Descriptions[strings.ToLower(record.Description)]; OK && record.Description != "" {
+		return activity
+	}
+	if m.Default != "" {
+		return m.Default
+	}
+	if record.Project != "" {
+		return record.Project
+	}
+	if len(record.Tags) > 0 {
+		return record.Tags[0]
+	}
+	return record.Description
+}
+
+// prepareRecords gives every record its activity and sets aside the ones that can't become sessions
+func prepareRecords(records []importRecord, mapping *activityMapping) ([]importRecord, []string) {
+	valid := make([]importRecord, 0, len(records))
+	invalid := make([]string, 0)
+	now := time.Now()
+	for _, record := range records {
+		record.Activity = strings.TrimSpace(mapping.activity(record))
+		switch {
+		case record.Activity == "":
+			invalid = append(invalid, fmt.Sprintf("row %d: no activity", record.Row))
+		case !record.End.After(record.Start):
+			invalid = append(invalid, fmt.Sprintf("row %d: the session ends before it starts", record.Row))
+		case record.End.After(now):
+			invalid = append(invalid, fmt.Sprintf("row %d: the session ends in the future", record.Row))
+		default:
+			valid = append(valid, record)
+		}
+	}
+	return valid, invalid
+}
+
+// importOptions are the command line options the readers of the import formats may use
+type importOptions struct {
+	ColumnMapping map[string]string
+	TimeFormat    string
+}
+
+// importReader reads the sessions of a file, returning rows that can't be read as invalid
+// and entries that aren't sessions as skipped
+type importReader func(filename string, opts importOptions) (records []importRecord, invalid []string, skipped []string, err error)
+
+// readers of the formats accepted by the import command
+var importReaders = map[string]importReader{
+	"gotimeit":    readTableFile,
+	"toggl":       readPresetTableFile(togglColumns),
+	"clockify":    readPresetTableFile(clockifyColumns),
+	"timewarrior": readTimewarrior,
+	"timeclock":   readTimeclock,
+	"wakatime":    readWakaTime,
+}
+
+func importReaderFormats() string {
+	formats := make([]string, 0, len(importReaders))
+	for format := range importReaders {
+		formats = append(formats, format)
+	}
+	sort.Strings(formats)
+	return strings.Join(formats, ", ")
+}
+
+// readTableFile reads the csv, json and json lines files written by export or by hand
+func readTableFile(filename string, opts importOptions) ([]importRecord, []string, []string, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	defer f.Close()
+
+	header, rows, err := readTable(f, filename)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	records, invalid, err := parseTable(header, rows, opts.ColumnMapping, opts.TimeFormat)
+	return records, invalid, nil, err
+}
+
+// columns of the detailed csv reports of Toggl Track
+var togglColumns = map[string]string{
+	"project":     "Project",
+	"description": "Description",
+	"tags":        "Tags",
+	"start_date":  "Start date",
+	"start":       "Start time",
+	"end_date":    "End date",
+	"end":         "End time",
+}
+
+// columns of the detailed csv reports of Clockify
+var clockifyColumns = map[string]string{
+	"project":     "Project",
+	"description": "Description",
+	"tags":        "Tags",
+	"start_date":  "Start Date",
+	"start":       "Start Time",
+	"end_date":    "End Date",
+	"end":         "End Time",
+}
+
+// readPresetTableFile reads csv exports of other trackers whose columns are known,
+// columns given on the command line still take precedence
+func readPresetTableFile(columns map[string]string) importReader {
+	return func(filename string, opts importOptions) ([]importRecord, []string, []string, error) {
+		if strings.ToLower(filepath.Ext(filename)) != ".csv" {
+			return nil, nil, nil, fmt.Errorf("unsupported file %s, expected a .csv file", filename)
+		}
+		mapping := make(map[string]string)
+		for field, column := range columns {
+			mapping[field] = column
+		}
+		for field, column := range opts.ColumnMapping {
+			mapping[field] = column
+		}
+		opts.ColumnMapping = mapping
+		return readTableFile(filename, opts)
+	}
+}
+
+// readTimewarrior reads a Timewarrior data file, or every *.data file of a data directory, made of lines like
+//
+//	inc 20261018T090000Z - 20261018T103000Z # programming "open source" # annotation
+func readTimewarrior(filename string, opts importOptions) ([]importRecord, []string, []string, error) {
+	files := []string{filename}
+	fi, err := os.Stat(filename)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if fi.IsDir() {
+		files, err = filepath.Glob(filepath.Join(filename, "*.data"))
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		sort.Strings(files)
+	}
+
+	records := make([]importRecord, 0)
+	invalid := make([]string, 0)
+	skipped := make([]string, 0)
+	row := 0
+	for _, file := range files {
+		f, err := os.Open(file)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			line := strings.TrimSpace(scanner.Text())
+			if !strings.HasPrefix(line, "inc ") {
+				continue
+			}
+			row++
+			record, running, err := parseTimewarriorLine(line)
+			switch {
+			case err != nil:
+				invalid = append(invalid, fmt.Sprintf("row %d: %v", row, err))
+			case running:
+				skipped = append(skipped, fmt.Sprintf("row %d: the interval is still running", row))
+			default:
+				record.Row = row
+				records = append(records, record)
+			}
+		}
+		err = scanner.Err()
+		f.Close()
+		if err != nil {
+			return nil, nil, nil, err
+		}
+	}
+	return records, invalid, skipped, nil
+}
+
+func parseTimewarriorLine(line string) (importRecord, bool, error) {
+	var record importRecord
+	interval, rest, _ := strings.Cut(strings.TrimPrefix(line, "inc "), " # ")
+	tags, annotation, _ := strings.Cut(rest, " # ")
+
+	startStr, endStr, closed := strings.Cut(strings.TrimSpace(interval), " - ")
+	start, err := time.Parse("20060102T150405Z", strings.TrimSpace(startStr))
+	if err != nil {
+		return record, false, fmt.Errorf("invalid start %q", startStr)
+	}
+	if !closed {
+		return record, true, nil
+	}
+	end, err := time.Parse("20060102T150405Z", strings.TrimSpace(endStr))
+	if err != nil {
+		return record, false, fmt.Errorf("invalid end %q", endStr)
+	}
+	record.Start, record.End = start.Local(), end.Local()
+	record.Tags = splitQuoted(tags)
+	record.Description = strings.Trim(strings.TrimSpace(annotation), `"`)
+	return record, false, nil
+}
+
+// splitQuoted splits s on spaces, keeping double quoted words containing spaces together
+func splitQuoted(s string) []string {
+	words := make([]string, 0)
+	var word strings.Builder
+	quoted, escaped := false, false
+	for _, r := range s {
+		switch {
+		case escaped:
+			word.WriteRune(r)
+			escaped = false
+		case r == '\\':
+			escaped = true
+		case r == '"':
+			quoted = !quoted
+		case r == ' ' && !quoted:
+			if word.Len() > 0 {
+				words = append(words, word.String())
+				word.Reset()
+			}
+		default:
+			word.WriteRune(r)
+		}
+	}
+	if word.Len() > 0 {
+		words = append(words, word.String())
+	}
+	return words
+}
+
+// heartbeats further apart than this start a new session, like WakaTime's default keystroke timeout
+const wakaTimeTimeout = 15 * time.Minute
+
+type wakaTimeDump struct {
+	Days []struct {
+		Date       string `json:"date"`
+		Heartbeats []struct {
+			Time     float64 `json:"time"`
+			Project  string  `json:"project"`
+			Entity   string  `json:"entity"`
+			Language string  `json:"language"`
+			Category string  `json:"category"`
+		} `json:"heartbeats"`
+		Projects []json.RawMessage `json:"projects"`
+	} `json:"days"`
+}
+
+// readWakaTime reads a WakaTime data dump. Only heartbeats carry the time at which work happened,
+// consecutive heartbeats of a project become one session. Days exported as daily totals are skipped
+func readWakaTime(filename string, opts importOptions) ([]importRecord, []string, []string, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	defer f.Close()
+
+	var dump wakaTimeDump
+	err = json.NewDecoder(io.Reader(f)).Decode(&dump)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("invalid WakaTime dump %s: %v", filename, err)
+	}
+
+	records := make([]importRecord, 0)
+	skipped := make([]string, 0)
+	for _, day := range dump.Days {
+		if len(day.Heartbeats) == 0 {
+			if len(day.Projects) > 0 {
+				skipped = append(skipped, fmt.Sprintf("%s: only daily totals, no heartbeats", day.Date))
+			}
+			continue
+		}
+		heartbeats := day.Heartbeats
+		sort.Slice(heartbeats, func(i, j int) bool { return heartbeats[i].Time < heartbeats[j].Time })
+
+		var current *importRecord
+		for _, heartbeat := range heartbeats {
+			sec, frac := math.Modf(heartbeat.Time)
+			t := time.Unix(int64(sec), int64(frac*1e9)).Local()
+			if current != nil && current.Project == heartbeat.Project && t.Sub(current.End) <= wakaTimeTimeout {
+				current.End = t
+				continue
+			}
+			if current != nil {
+				records = append(records, *current)
+			}
+			tags := make([]string, 0, 2)
+			for _, tag := range []string{heartbeat.Category, heartbeat.Language} {
+				if tag != "" {
+					tags = append(tags, tag)
+				}
+			}
+			current = &importRecord{
+				Row:     len(records) + 1,
+				Start:   t,
+				End:     t,
+				Project: heartbeat.Project,
+				Tags:    tags,
+			}
+		}
+		records = append(records, *current)
+	}
+
+	// a lone heartbeat is an instant, not a session
+	sessions := make([]importRecord, 0, len(records))
+	for _, record := range records {
+		if record.End.Sub(record.Start) < time.Minute {
+			skipped = append(skipped, fmt.Sprintf("row %d: %s at %s is shorter than a minute", record.Row, record.Project, record.Start.Format("2006-01-02 15:04")))
+			continue
+		}
+		sessions = append(sessions, record)
+	}
+	return sessions, nil, skipped, nil
+}
@@ -2,20 +2,21 @@ package main
 
 import (
 	"context"
+	"fmt"
 	"log"
 	"os"
+	"time"
 
 	"github.com/urfave/cli/v3"
 )
 
-func init() {
+func main() {
+	// opened here rather than in init so that the tests run against a database of their own
 	err := initializeDB()
 	if err != nil {
 		log.Fatalln("failed o initialize database")
 	}
-}
 
-func main() {
 	app := &cli.Command{
 		Name:  "Time Tracking CLI",
 		Usage: "A simple CLI to measure time spent on hobbies",
@@ -46,14 +47,359 @@ func main() {
 			},
 
 			{
-				Name:   "summary",
-				Usage:  "Generates an interactive HTML summary with graphs. Starts a web server on port 4000 to view and manage sessions",
+				Name:  "summary",
+				Usage: "Generates an interactive HTML summary with graphs. Starts a web server, on localhost:4000 by default, to view and manage sessions",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:  "addr",
+						Usage: "Address the server listens on, e.g. 0.0.0.0:4000 to accept connections from other machines",
+						Value: "127.0.0.1:4000",
+					},
+					&cli.IntFlag{
+						Name:  "port",
+						Usage: "Port the server listens on instead of the one of --addr, 0 picks a free port",
+					},
+					&cli.StringFlag{
+						Name:  "socket",
+						Usage: "Listens on a Unix socket, only accessible to the current user, instead of --addr",
+					},
+					&cli.BoolFlag{
+						Name:  "open",
+						Usage: "Opens the dashboard in the browser once the server is started",
+					},
+					&cli.BoolFlag{
+						Name:  "auth",
+						Usage: "Requires the password (gotimeit password set) to use the dashboard and an api token (gotimeit token create) to use the json api",
+					},
+				},
 				Action: handleSummary,
 			},
+
+			{
+				Name:  "build-site",
+				Usage: "Writes a read-only copy of the summary dashboard as static files that any web host can serve",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:  "out",
+						Usage: "Directory the site is written to",
+						Value: "public",
+					},
+				},
+				Action: handleBuildSite,
+			},
+
+			{
+				Name:  "stats",
+				Usage: "Displays when you work: a weekday by hour punch card, session lengths and the longest session per activity",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:  "from",
+						Usage: "First day (yyyy-mm-dd) to include, defaults to a year before --to",
+					},
+					&cli.StringFlag{
+						Name:  "to",
+						Usage: "Last day (yyyy-mm-dd) to include, defaults to today",
+					},
+					&cli.StringSliceFlag{
+						Name:  "activity",
+						Usage: "Only include the given activity, can be repeated",
+					},
+				},
+				Action: handleStats,
+			},
+
+			{
+				Name:  "compare",
+				Usage: "Compares the time spent on each activity in the current period with the previous one",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:  "period",
+						Usage: "Length of the compared periods: week, month or year",
+						Value: "week",
+					},
+				},
+				Action: handleCompare,
+			},
+
+			{
+				Name:  "review",
+				Usage: "Generates a year in review report with the year's totals, top activities, streaks and month by month charts",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:  "year",
+						Usage: "Year to review",
+						Value: fmt.Sprintf("%d", time.Now().Year()),
+					},
+					&cli.StringFlag{
+						Name:  "format",
+						Usage: "Format of the report: html, md or json",
+						Value: "html",
+					},
+					&cli.StringFlag{
+						Name:  "out",
+						Usage: "File the report is written to, - for stdout. Defaults to gotimeit-review-<year>.<format>",
+					},
+				},
+				Action: handleReview,
+			},
+
+			{
+				Name:  "heatmap",
+				Usage: "Displays the GitHub-like activity chart in the terminal",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:  "year",
+						Usage: "Year to display, defaults to the last 12 months",
+					},
+					&cli.StringSliceFlag{
+						Name:  "activity",
+						Usage: "Only include the given activity, can be repeated",
+					},
+					&cli.StringFlag{
+						Name:  "theme",
+						Usage: "Colors of the chart: light, dark or high-contrast",
+						Value: "light",
+					},
+					&cli.BoolFlag{
+						Name:  "no-color",
+						Usage: "Draw the chart with plain ASCII characters",
+					},
+				},
+				Action: handleHeatmap,
+			},
+
+			{
+				Name:  "badge",
+				Usage: "Writes the activity chart as a standalone svg image, e.g. for a README",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:  "year",
+						Usage: "Year to draw, defaults to the last 12 months",
+					},
+					&cli.StringSliceFlag{
+						Name:  "activity",
+						Usage: "Only include the given activity, can be repeated",
+					},
+					&cli.StringFlag{
+						Name:  "theme",
+						Usage: "Colors of the image: light, dark or high-contrast",
+						Value: "light",
+					},
+					&cli.StringFlag{
+						Name:  "cell",
+						Usage: "Size of the day cells in pixels, from 4 to 32",
+						Value: "10",
+					},
+					&cli.StringFlag{
+						Name:  "out",
+						Usage: "File the image is written to, - for stdout",
+						Value: "heatmap.svg",
+					},
+				},
+				Action: handleBadge,
+			},
+
+			{
+				Name:  "timeline",
+				Usage: "Displays the sessions of a day on a 24 hour bar in the terminal",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:  "date",
+						Usage: "Day (yyyy-mm-dd) to display, defaults to today",
+					},
+					&cli.BoolFlag{
+						Name:  "no-color",
+						Usage: "Draw the timeline with plain ASCII characters",
+					},
+				},
+				Action: handleTimeline,
+			},
+
+			{
+				Name:  "export",
+				Usage: "Exports sessions, or the daily time spent on each activity, to stdout or a file",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:  "format",
+						Usage: "Format of the export: csv, json, jsonl, ics (iCalendar) or timeclock (sessions only, for ledger and hledger)",
+						Value: "csv",
+					},
+					&cli.StringFlag{
+						Name:  "from",
+						Usage: "First day (yyyy-mm-dd) to export, defaults to the oldest session",
+					},
+					&cli.StringFlag{
+						Name:  "to",
+						Usage: "Last day (yyyy-mm-dd) to export, defaults to the latest session",
+					},
+					&cli.StringSliceFlag{
+						Name:  "activity",
+						Usage: "Only export the given activity, can be repeated",
+					},
+					&cli.BoolFlag{
+						Name:  "daily",
+						Usage: "Export the total time spent on each activity per day instead of the sessions",
+					},
+					&cli.StringFlag{
+						Name:  "out",
+						Usage: "File the export is written to, defaults to stdout",
+					},
+				},
+				Action: handleExport,
+			},
+
+			{
+				Name:      "import",
+				Usage:     "Imports sessions from a csv, json or json lines file, or from the exports of Timewarrior, Toggl, Clockify and WakaTime, skipping duplicates and sessions overlapping existing ones",
+				ArgsUsage: "<file>",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:  "from-format",
+						Value: "gotimeit",
+						Usage: "Format of the file: gotimeit (csv, json or json lines), timeclock (ledger and hledger), timewarrior (a .data file or the data directory), toggl or clockify (detailed csv reports) or wakatime (json data dump)",
+					},
+					&cli.StringFlag{
+						Name:  "mapping",
+						Usage: "JSON file mapping projects, tags and descriptions onto activities, e.g. {\"projects\": {\"Website\": \"programming\"}, \"tags\": {}, \"descriptions\": {}, \"default\": \"misc\"}",
+					},
+					&cli.StringSliceFlag{
+						Name:  "column",
+						Usage: "Reads a field (activity, project, tags, description, start, end, minutes, date, start_date or end_date) from another column, e.g. --column activity=Project",
+					},
+					&cli.StringFlag{
+						Name:  "time-format",
+						Usage: "Go layout of the start and end columns, e.g. \"2006-01-02 15:04\", detected when not given",
+					},
+					&cli.BoolFlag{
+						Name:  "dry-run",
+						Usage: "Reports what would be imported without changing the database",
+					},
+				},
+				Action: handleImport,
+			},
+
+			{
+				Name:      "import-ics",
+				Usage:     "Imports the events of an iCalendar file, recurring events included, as sessions of an activity. Events already imported, or overlapping existing sessions, are skipped",
+				ArgsUsage: "<file.ics>",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:  "activity",
+						Usage: "Activity of the imported sessions",
+						Value: "meetings",
+					},
+					&cli.StringFlag{
+						Name:  "from",
+						Usage: "First day (yyyy-mm-dd) of the events to import, defaults to 30 days before --to",
+					},
+					&cli.StringFlag{
+						Name:  "to",
+						Usage: "Last day (yyyy-mm-dd) of the events to import, defaults to today",
+					},
+					&cli.BoolFlag{
+						Name:  "dry-run",
+						Usage: "Reports what would be imported without changing the database",
+					},
+				},
+				Action: handleImportICS,
+			},
+
+			{
+				Name:  "token",
+				Usage: "Manages the tokens authenticating clients of the json api when the server runs with --auth",
+				Commands: []*cli.Command{
+					{
+						Name:  "create",
+						Usage: "Creates a token and prints it, only its hash is stored",
+						Flags: []cli.Flag{
+							&cli.StringFlag{
+								Name:  "name",
+								Usage: "Name telling what the token is for, e.g. laptop",
+							},
+						},
+						Action: handleTokenCreate,
+					},
+					{
+						Name:   "list",
+						Usage:  "Lists the tokens",
+						Action: handleTokenList,
+					},
+					{
+						Name:      "revoke",
+						Usage:     "Revokes a token, given by its name or id",
+						ArgsUsage: "[<name|id>]",
+						Flags: []cli.Flag{
+							&cli.IntFlag{
+								Name:  "id",
+								Usage: "id of the token, when a token is named like the id of another one",
+							},
+							&cli.StringFlag{
+								Name:  "name",
+								Usage: "name of the token, when it's the id of another one",
+							},
+						},
+						Action: handleTokenRevoke,
+					},
+				},
+			},
+
+			{
+				Name:  "password",
+				Usage: "Manages the password of the dashboard when the server runs with --auth",
+				Commands: []*cli.Command{
+					{
+						Name:   "set",
+						Usage:  "Sets the password, read from stdin",
+						Action: handlePasswordSet,
+					},
+					{
+						Name:   "clear",
+						Usage:  "Removes the password",
+						Action: handlePasswordClear,
+					},
+				},
+			},
+
+			{
+				Name:  "theme",
+				Usage: "Lists the dashboard themes and starts a theme directory overriding its templates and stylesheets",
+				Commands: []*cli.Command{
+					{
+						Name:   "list",
+						Usage:  "Lists the available themes, the current one being starred",
+						Action: handleThemeList,
+					},
+					{
+						Name:      "init",
+						Usage:     "Copies the built-in templates and stylesheets to a directory to be edited",
+						ArgsUsage: "<dir>",
+						Action:    handleThemeInit,
+					},
+				},
+			},
+
+			{
+				Name:  "config",
+				Usage: "Reads and changes settings, e.g. week_start (sunday, monday, ...) used by the heatmap and weekly reports, theme, theme_dir and palette.<activity>",
+				Commands: []*cli.Command{
+					{
+						Name:      "get",
+						Usage:     "Prints the current value of a setting",
+						ArgsUsage: "<key>",
+						Action:    handleConfigGet,
+					},
+					{
+						Name:      "set",
+						Usage:     "Changes the value of a setting",
+						ArgsUsage: "<key> <value>",
+						Action:    handleConfigSet,
+					},
+				},
+			},
 		},
 	}
 
-	err := app.Run(context.Background(), os.Args)
+	err = app.Run(context.Background(), os.Args)
 	if err != nil {
 		log.Fatal(err)
 	}
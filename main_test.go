@@ -0,0 +1,94 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// useTestDB runs the test in a directory of its own, against an empty database, and forgets
+// the charts cached by the previous tests
+func useTestDB(t testing.TB) {
+	t.Helper()
+	t.Chdir(t.TempDir())
+	err := initializeDB()
+	if err != nil {
+		t.Fatalf("initializing the database: %v", err)
+	}
+	charts.clear()
+	err = setYearsOptions()
+	if err != nil {
+		t.Fatalf("reading the years with sessions: %v", err)
+	}
+	err = initializeTemplates()
+	if err != nil {
+		t.Fatalf("parsing the templates: %v", err)
+	}
+}
+
+// doRequest sends r to handler and returns the response. Requests are for localhost, which the server
+// accepts without authentication, unless the test gave them another host
+func doRequest(handler http.Handler, r *http.Request) *httptest.ResponseRecorder {
+	// the host httptest.NewRequest gives requests
+	if r.Host == "example.com" {
+		r.Host = "localhost:4000"
+	}
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	return w
+}
+
+// checkStatuses sends a GET request to handler for each target of want, checking the status it answers
+func checkStatuses(t *testing.T, handler http.Handler, want map[string]int) {
+	t.Helper()
+	for target, status := range want {
+		if w := doRequest(handler, httptest.NewRequest(http.MethodGet, target, nil)); w.Code != status {
+			t.Errorf("GET %s answered %d, want %d", target, w.Code, status)
+		}
+	}
+}
+
+// mustAddSession records a session of minutes started at start
+func mustAddSession(t testing.TB, activity string, start time.Time, minutes int) *Session {
+	t.Helper()
+	session, err := addSession(activity, start, start.Add(time.Duration(minutes)*time.Minute))
+	if err != nil {
+		t.Fatalf("adding a %s session: %v", activity, err)
+	}
+	return session
+}
+
+// dumpSessions returns every row of the activitysessions table, to check that a request changed nothing
+func dumpSessions(t *testing.T) string {
+	t.Helper()
+	db, err := getDBConnection()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	rows, err := db.Query(`SELECT id, date, activity, start_time, stop_time FROM activitysessions ORDER BY id`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	var dump strings.Builder
+	for rows.Next() {
+		row := make([]any, 5)
+		pointers := make([]any, len(row))
+		for i := range row {
+			pointers[i] = &row[i]
+		}
+		err = rows.Scan(pointers...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fmt.Fprintln(&dump, row...)
+	}
+	if err = rows.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return dump.String()
+}
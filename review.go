@@ -0,0 +1,192 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// number of activities listed in the top activities of the review
+const reviewTopActivities = 5
+
+// computeYearReview gathers the highlights of every session dated in year
+func computeYearReview(year string) (*YearReview, error) {
+	y, err := strconv.Atoi(year)
+	if err != nil {
+		return nil, fmt.Errorf("invalid year %q", year)
+	}
+	weekStart, err := getWeekStart()
+	if err != nil {
+		return nil, err
+	}
+	sessions, err := getSessionsBetween(fmt.Sprintf("%d-01-01", y), fmt.Sprintf("%d-12-31", y), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	review := &YearReview{
+		Year:          year,
+		SessionCount:  len(sessions),
+		TopActivities: make([]ReviewActivity, 0, reviewTopActivities),
+		Months:        make([]ReviewMonth, 12),
+	}
+
+	var total time.Duration
+	byActivity := make(map[string]time.Duration)
+	byDay := make(map[string]time.Duration)
+	byWeek := make(map[string]time.Duration)
+	byMonth := make([]time.Duration, 12)
+	var byHour [24]float64
+	for _, session := range sessions {
+		duration := session.Duration()
+		total += duration
+		byActivity[session.Activity] += duration
+		byDay[session.Date] += duration
+
+		date, err := time.Parse("2006-01-02", session.Date)
+		if err != nil {
+			return nil, err
+		}
+		byWeek[startOfWeek(date, weekStart).Format("2006-01-02")] += duration
+		byMonth[date.Month()-1] += duration
+
+		splitByHour(session, func(hourStart time.Time, minutes float64) {
+			byHour[hourStart.Hour()] += minutes
+		})
+	}
+
+	review.TotalDurationStr = formatDuration(total)
+	review.TotalMinutes = int(total.Minutes())
+	review.ActiveDays = len(byDay)
+	if len(sessions) == 0 {
+		for i := range review.Months {
+			review.Months[i] = ReviewMonth{Label: time.Month(i + 1).String(), DurationStr: formatDuration(0)}
+		}
+		return review, nil
+	}
+
+	first, last := sessions[0], sessions[len(sessions)-1]
+	review.FirstSession = newReviewSession(first)
+	review.LastSession = newReviewSession(last)
+
+	activities := make([]string, 0, len(byActivity))
+	for activity := range byActivity {
+		activities = append(activities, activity)
+	}
+	sort.Slice(activities, func(i, j int) bool {
+		if byActivity[activities[i]] == byActivity[activities[j]] {
+			return activities[i] < activities[j]
+		}
+		return byActivity[activities[i]] > byActivity[activities[j]]
+	})
+	for _, activity := range activities[:min(len(activities), reviewTopActivities)] {
+		review.TopActivities = append(review.TopActivities, ReviewActivity{
+			Activity:    activity,
+			DurationStr: formatDuration(byActivity[activity]),
+			Minutes:     int(byActivity[activity].Minutes()),
+			Percentage:  durationPercentage(byActivity[activity], total),
+		})
+	}
+
+	review.BusiestDay = busiestPeriod(byDay, func(key string) string { return key })
+	review.BusiestWeek = busiestPeriod(byWeek, func(key string) string { return "week of " + key })
+
+	var busiestMonth time.Duration
+	for i, duration := range byMonth {
+		if duration > busiestMonth {
+			busiestMonth = duration
+			review.BusiestMonth = newReviewPeriod(time.Month(i+1).String(), duration)
+		}
+	}
+	for i, duration := range byMonth {
+		review.Months[i] = ReviewMonth{
+			Label:       time.Month(i + 1).String(),
+			DurationStr: formatDuration(duration),
+			Minutes:     int(duration.Minutes()),
+			Percentage:  durationPercentage(duration, busiestMonth),
+		}
+	}
+
+	busiestHour := 0
+	for hour, minutes := range byHour {
+		if minutes > byHour[busiestHour] {
+			busiestHour = hour
+		}
+	}
+	review.MostProductiveHour = newReviewPeriod(
+		fmt.Sprintf("%02d:00 - %02d:00", busiestHour, (busiestHour+1)%24),
+		time.Duration(byHour[busiestHour]*float64(time.Minute)),
+	)
+
+	review.LongestStreak = longestStreak(byDay)
+	return review, nil
+}
+
+// durationPercentage is part as a percentage of whole, 0 when no time was tracked at all,
+// e.g. when every session ended the second it started
+func durationPercentage(part, whole time.Duration) int {
+	if whole == 0 {
+		return 0
+	}
+	return int(part * 100 / whole)
+}
+
+// busiestPeriod returns the period with the most time tracked, the earliest one on ties
+func busiestPeriod(durations map[string]time.Duration, label func(key string) string) *ReviewPeriod {
+	var busiest string
+	for key, duration := range durations {
+		if busiest == "" || duration > durations[busiest] || (duration == durations[busiest] && key < busiest) {
+			busiest = key
+		}
+	}
+	if busiest == "" {
+		return nil
+	}
+	return newReviewPeriod(label(busiest), durations[busiest])
+}
+
+func newReviewPeriod(label string, duration time.Duration) *ReviewPeriod {
+	return &ReviewPeriod{Label: label, DurationStr: formatDuration(duration), Minutes: int(duration.Minutes())}
+}
+
+func newReviewSession(session Session) *ReviewSession {
+	return &ReviewSession{
+		Activity:    session.Activity,
+		Date:        session.Date,
+		Start:       session.Start.Format("15:04"),
+		DurationStr: formatDuration(session.Duration()),
+		Minutes:     int(session.Duration().Minutes()),
+	}
+}
+
+// longestStreak finds the longest run of consecutive days with time tracked
+func longestStreak(byDay map[string]time.Duration) *ReviewStreak {
+	days := make([]string, 0, len(byDay))
+	for day := range byDay {
+		days = append(days, day)
+	}
+	sort.Strings(days)
+
+	streak := &ReviewStreak{}
+	var start, previous time.Time
+	length := 0
+	for _, day := range days {
+		date, err := time.Parse("2006-01-02", day)
+		if err != nil {
+			continue
+		}
+		if length > 0 && date.Equal(previous.AddDate(0, 0, 1)) {
+			length++
+		} else {
+			start, length = date, 1
+		}
+		previous = date
+		if length > streak.Days {
+			streak.Days = length
+			streak.From = start.Format("2006-01-02")
+			streak.To = date.Format("2006-01-02")
+		}
+	}
+	return streak
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestYearReviewOfSessionsWithoutDuration(t *testing.T) {
+	useTestDB(t)
+	// like gotimeit start then gotimeit end within the same second
+	start := time.Date(2025, time.March, 3, 9, 0, 0, 0, time.Local)
+	mustAddSession(t, "reading", start, 0)
+	mustAddSession(t, "writing", start.Add(time.Hour), 0)
+
+	review, err := computeYearReview("2025")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if review.SessionCount != 2 || review.TotalMinutes != 0 {
+		t.Fatalf("the review counts %d sessions and %d minutes, want 2 sessions and 0 minutes", review.SessionCount, review.TotalMinutes)
+	}
+	for _, activity := range review.TopActivities {
+		if activity.Percentage != 0 {
+			t.Errorf("%s takes %d%% of the year, want 0", activity.Activity, activity.Percentage)
+		}
+	}
+	for _, month := range review.Months {
+		if month.Percentage != 0 {
+			t.Errorf("%s is at %d%% of the busiest month, want 0", month.Label, month.Percentage)
+		}
+	}
+}
+
+func TestYearReviewMarkdownKeepsActivityNames(t *testing.T) {
+	useTestDB(t)
+	start := time.Date(2025, time.May, 5, 9, 0, 0, 0, time.Local)
+	mustAddSession(t, "R&D <x> 'q'", start, 90)
+	mustAddSession(t, "a|b\nc", start.Add(2*time.Hour), 30)
+
+	review, err := computeYearReview("2025")
+	if err != nil {
+		t.Fatal(err)
+	}
+	markdown, err := renderReview(review, "md")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"| R&D <x> 'q' | 1 hr(s) & 30 min(s) | 75% |",
+		`| a\|b c | 0 hr(s) & 30 min(s) | 25% |`,
+		`- **Last session:** a\|b c on 2025-05-05`,
+	} {
+		if !strings.Contains(string(markdown), want) {
+			t.Errorf("the markdown report has no line %q:\n%s", want, markdown)
+		}
+	}
+}
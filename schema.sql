@@ -1,4 +1,9 @@
 DROP TABLE IF EXISTS activitysessions;
+DROP TABLE IF EXISTS settings;
+DROP TABLE IF EXISTS imported_events;
+DROP TABLE IF EXISTS api_tokens;
+DROP TABLE IF EXISTS login_sessions;
+DROP TABLE IF EXISTS session_changes;
 
 CREATE TABLE IF NOT EXISTS activitysessions (
     id INTEGER PRIMARY KEY AUTOINCREMENT,
@@ -6,4 +11,65 @@ CREATE TABLE IF NOT EXISTS activitysessions (
     activity TEXT NOT NULL,
     start_time TIMESTAMP NOT NULL,
 	stop_time TIMESTAMP
-);
\ No newline at end of file
+);
+
+CREATE TABLE IF NOT EXISTS settings (
+    key TEXT PRIMARY KEY,
+    value TEXT NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS imported_events (
+    uid TEXT NOT NULL,
+    occurrence INTEGER NOT NULL,
+    session_id INTEGER NOT NULL,
+    PRIMARY KEY (uid, occurrence)
+);
+
+CREATE TABLE IF NOT EXISTS api_tokens (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    name TEXT NOT NULL UNIQUE,
+    hash TEXT NOT NULL UNIQUE,
+    created_at INTEGER NOT NULL,
+    last_used_at INTEGER
+);
+
+CREATE TABLE IF NOT EXISTS login_sessions (
+    hash TEXT PRIMARY KEY,
+    expires_at INTEGER NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS session_changes (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    date TEXT,
+    changed_at INTEGER NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS session_changes_date ON session_changes(date);
+
+CREATE TRIGGER IF NOT EXISTS activitysessions_inserted AFTER INSERT ON activitysessions BEGIN
+    DELETE FROM session_changes WHERE date = NEW.date;
+    INSERT INTO session_changes(date, changed_at) VALUES (NEW.date, CAST(strftime('%s', 'now') AS INTEGER));
+END;
+
+CREATE TRIGGER IF NOT EXISTS activitysessions_updated AFTER UPDATE ON activitysessions BEGIN
+    DELETE FROM session_changes WHERE date IN (OLD.date, NEW.date);
+    INSERT INTO session_changes(date, changed_at) VALUES (OLD.date, CAST(strftime('%s', 'now') AS INTEGER));
+    INSERT INTO session_changes(date, changed_at) SELECT NEW.date, CAST(strftime('%s', 'now') AS INTEGER) WHERE NEW.date != OLD.date;
+END;
+
+CREATE TRIGGER IF NOT EXISTS activitysessions_deleted AFTER DELETE ON activitysessions BEGIN
+    DELETE FROM session_changes WHERE date = OLD.date;
+    INSERT INTO session_changes(date, changed_at) VALUES (OLD.date, CAST(strftime('%s', 'now') AS INTEGER));
+END;
+
+CREATE TRIGGER IF NOT EXISTS settings_inserted AFTER INSERT ON settings WHEN NEW.key = 'week_start' OR NEW.key LIKE 'palette.%' BEGIN
+    DELETE FROM session_changes WHERE date IS NULL;
+    INSERT INTO session_changes(date, changed_at) VALUES (NULL, CAST(strftime('%s', 'now') AS INTEGER));
+END;
+
+CREATE TRIGGER IF NOT EXISTS settings_updated AFTER UPDATE ON settings WHEN NEW.key = 'week_start' OR NEW.key LIKE 'palette.%' BEGIN
+    DELETE FROM session_changes WHERE date IS NULL;
+    INSERT INTO session_changes(date, changed_at) VALUES (NULL, CAST(strftime('%s', 'now') AS INTEGER));
+END;
+
+PRAGMA user_version = 1;
@@ -1,13 +1,18 @@
 package main
 
 import (
+	"bytes"
 	"context"
 	"errors"
 	"fmt"
 	"log"
+	"net"
 	"net/http"
 	"os"
+	"os/exec"
 	"os/signal"
+	"runtime"
+	"strconv"
 	"strings"
 	"syscall"
 	"time"
@@ -15,16 +20,38 @@ import (
 	"github.com/go-chi/chi/v5"
 )
 
-func routes() http.Handler {
+func routes(cfg ServerConfig) http.Handler {
 	router := chi.NewRouter()
+	if cfg.Auth {
+		router.Use(authenticate)
+	} else if cfg.Socket == "" {
+		// only the current user can reach the socket, and browsers can't
+		listenHost, _, err := net.SplitHostPort(cfg.Addr)
+		if err != nil {
+			listenHost = cfg.Addr
+		}
+		router.Use(hostProtect(listenHost))
+	}
+	router.Use(csrfProtect)
 
 	router.HandleFunc("/summary", activityChartHandler)
 	router.HandleFunc("/segments", segmentsHandler)
+	router.HandleFunc("/stats", statsHandler)
+	router.HandleFunc("/compare", compareHandler)
+	router.HandleFunc("/calendar.ics", calendarHandler)
+	router.HandleFunc("/badge.svg", badgeHandler)
+	router.Get("/events", eventsHandler)
+	router.HandleFunc("/static/*", staticHandler)
 	router.HandleFunc("/", homeHandler)
+	router.Get("/login", loginHandler)
+	router.Post("/login", loginHandler)
+	router.Post("/logout", logoutHandler)
+
+	router.Route("/api/v1", apiRoutes)
 
 	router.Route("/sessions", func(r chi.Router) {
-		r.Get("/end", endSessionHandler)
-		r.Get("/start", startSessionHandler)
+		r.Post("/end", endSessionHandler)
+		r.Post("/start", startSessionHandler)
 	})
 
 	return router
@@ -38,6 +65,13 @@ func homeHandler(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 		return
 	}
+	tmplData.AuthRequired = authRequired
+	tmplData.CSRFToken, err = csrfToken(w, r)
+	if err != nil {
+		log.Println(err.Error())
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
 	homepageBytes, err := renderHomepage(tmplData)
 	if err != nil {
 		log.Println(err.Error())
@@ -54,21 +88,20 @@ func activityChartHandler(w http.ResponseWriter, r *http.Request) {
 	year := strings.TrimSpace(query.Get("year"))
 	// fmt.Printf("activityChartHandler: %s\n", year)
 	if year == "" {
-		year = fmt.Sprintf("%d", time.Now().Year())
+		year = ROLLING_YEAR
 	}
+	if _, _, _, err := chartWindow(year, time.Now()); err != nil {
+		http.Error(w, fmt.Sprintf("invalid year %q, expected a year or %s", year, ROLLING_YEAR), http.StatusBadRequest)
+		return
+	}
+	// the chart can be narrowed down to one or more activities
+	activities := query["activity"]
 
-	mu.Lock()
-	defer mu.Unlock()
-	chartData, OK := chartDataByYear[year]
-	if !OK {
-		cd, err := computeChartDataForYear(year)
-		if err != nil {
-			log.Println(err.Error())
-			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
-			return
-		}
-		chartDataByYear[year] = cd
-		chartData = cd
+	chartData, err := getChartData(year, activities)
+	if err != nil {
+		log.Println(err.Error())
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
 	}
 	// writes the rendered activity_chart.html to w
 	chartHTMLBytes, err := renderChart(chartData)
@@ -82,14 +115,18 @@ func activityChartHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 func startSessionHandler(w http.ResponseWriter, r *http.Request) {
-	query := r.URL.Query()
-	activity := strings.TrimSpace(query.Get("activity"))
+	activity := strings.TrimSpace(r.PostFormValue("activity"))
+	if activity == "" {
+		http.Error(w, "the activity can't be empty", http.StatusBadRequest)
+		return
+	}
 	activeSessionActivity, err := startSession(activity)
 	if err != nil {
 		if err.Error() == ErrStartSession {
 			errString := fmt.Sprintf("a session with activity %s is already in progress. Please end the current session before starting a new one", activeSessionActivity)
 			http.Error(w, errString, http.StatusBadRequest)
 		} else {
+			log.Println(err.Error())
 			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 		}
 		return
@@ -111,10 +148,12 @@ func endSessionHandler(w http.ResponseWriter, r *http.Request) {
 		if err.Error() == ErrEndSession {
 			http.Error(w, ErrEndSession, http.StatusBadRequest)
 		} else {
+			log.Println(err.Error())
 			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
-			return
 		}
+		return
 	}
+	refreshChartData(date)
 
 	startSessionHTMLBytes, err := renderStartSessionAction()
 	if err != nil {
@@ -124,30 +163,239 @@ func endSessionHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	w.Write(startSessionHTMLBytes)
-
-	go func() {
-		updateChartDataForCurrentYear(date)
-	}()
-
 }
 
 func segmentsHandler(w http.ResponseWriter, r *http.Request) {
-	query := r.URL.Query()
-	date := strings.TrimSpace(query.Get("date"))
+	date, err := parseDateParam(r, "date")
+	if err != nil {
+		badRequestResponse(w, r, err)
+		return
+	}
 	segments, err := getSegmentsFor(date)
 	if err != nil {
-		fmt.Println("error fetching segments from db", err)
+		serverErrorResponse(w, r, err)
 		return
 	}
 	data := envelope{"Segments": segments}
-	writeJSON(w, http.StatusOK, data, nil)
+	err = writeJSON(w, http.StatusOK, data, nil)
+	if err != nil {
+		serverErrorResponse(w, r, err)
+	}
+}
+
+func statsHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	from, to, err := parseDateRange(strings.TrimSpace(query.Get("from")), strings.TrimSpace(query.Get("to")), 365)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	stats, err := computeStatistics(from, to, query["activity"])
+	if err != nil {
+		log.Println(err.Error())
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	stats.ActivityOptions, err = getActivities()
+	if err != nil {
+		log.Println(err.Error())
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	statsHTMLBytes, err := renderStats(stats)
+	if err != nil {
+		log.Println(err.Error())
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Write(statsHTMLBytes)
+}
+
+func compareHandler(w http.ResponseWriter, r *http.Request) {
+	period := strings.TrimSpace(r.URL.Query().Get("period"))
+	if period == "" {
+		period = "week"
+	}
+	err := validatePeriod(period)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	comparison, err := comparePeriods(period, time.Now())
+	if err != nil {
+		log.Println(err.Error())
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	compareHTMLBytes, err := renderComparison(comparison)
+	if err != nil {
+		log.Println(err.Error())
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Write(compareHTMLBytes)
 }
 
-func serve() error {
+// calendarHandler serves the sessions of the last year, or of the from and to query parameters,
+// as an iCalendar feed calendar apps can subscribe to
+func calendarHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	from, to, err := parseDateRange(strings.TrimSpace(query.Get("from")), strings.TrimSpace(query.Get("to")), 365)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var buf bytes.Buffer
+	err = exportSessions(&buf, "ics", from, to, query["activity"], false)
+	if err != nil {
+		log.Println(err.Error())
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+	w.Header().Set("Content-Disposition", `inline; filename="gotimeit.ics"`)
+	w.Write(buf.Bytes())
+}
+
+// badgeHandler serves the heatmap as a standalone svg image for READMEs and personal sites
+func badgeHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	year := strings.TrimSpace(query.Get("year"))
+	if year == "" {
+		year = ROLLING_YEAR
+	}
+	theme, OK := heatmapThemes[strings.TrimSpace(query.Get("theme"))]
+	if query.Get("theme") == "" {
+		theme, OK = heatmapThemes["light"], true
+	}
+	if !OK {
+		http.Error(w, fmt.Sprintf("invalid theme, expected one of %s", heatmapThemeNames()), http.StatusBadRequest)
+		return
+	}
+	cell, err := parseBadgeCell(strings.TrimSpace(query.Get("cell")))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	chartData, err := getChartData(year, query["activity"])
+	if err != nil {
+		log.Println(err.Error())
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	badgeBytes, err := renderBadge(computeBadgeData(chartData, theme, cell))
+	if err != nil {
+		log.Println(err.Error())
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "image/svg+xml")
+	w.Header().Set("Cache-Control", "max-age=300")
+	w.Write(badgeBytes)
+}
+
+// listen opens the listener the server is configured with: a Unix socket only the user can use,
+// or a tcp address whose port, when --port is given, replaces the one of --addr
+func listen(cfg ServerConfig) (net.Listener, error) {
+	if cfg.Socket != "" {
+		// a socket left behind by a server that didn't shut down cleanly is removed, one in use isn't
+		if fi, err := os.Stat(cfg.Socket); err == nil && fi.Mode()&os.ModeSocket != 0 {
+			conn, err := net.Dial("unix", cfg.Socket)
+			if err == nil {
+				conn.Close()
+				return nil, fmt.Errorf("the socket %s is in use by another server", cfg.Socket)
+			}
+			err = os.Remove(cfg.Socket)
+			if err != nil {
+				return nil, err
+			}
+		}
+		listener, err := net.Listen("unix", cfg.Socket)
+		if err != nil {
+			return nil, err
+		}
+		err = os.Chmod(cfg.Socket, 0600)
+		if err != nil {
+			listener.Close()
+			return nil, err
+		}
+		return listener, nil
+	}
+
+	addr := cfg.Addr
+	if cfg.Port >= 0 {
+		host, _, err := net.SplitHostPort(addr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid address %q: %v", addr, err)
+		}
+		addr = net.JoinHostPort(host, strconv.Itoa(cfg.Port))
+	}
+	return net.Listen("tcp", addr)
+}
+
+// serverURL is the address a browser opens to reach the server listening on addr
+func serverURL(addr net.Addr) string {
+	host, port, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return "http://" + addr.String()
+	}
+	// a server listening on every interface is reachable on the loopback one
+	if ip := net.ParseIP(host); ip != nil && ip.IsUnspecified() {
+		host = "localhost"
+	}
+	return "http://" + net.JoinHostPort(host, port)
+}
+
+// openBrowser opens url with the desktop's default browser
+func openBrowser(url string) error {
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		cmd = exec.Command("open", url)
+	case "windows":
+		cmd = exec.Command("rundll32", "url.dll,FileProtocolHandler", url)
+	default:
+		cmd = exec.Command("xdg-open", url)
+	}
+	return cmd.Start()
+}
+
+func serve(cfg ServerConfig) error {
+	if cfg.Socket != "" && cfg.Open {
+		return errors.New("--open can't be used with --socket, browsers can't open Unix sockets")
+	}
+	if cfg.Auth {
+		err := checkCredentialsExist()
+		if err != nil {
+			return err
+		}
+	}
+	authRequired = cfg.Auth
+	listener, err := listen(cfg)
+	if err != nil {
+		return err
+	}
+	if tcpAddr, OK := listener.Addr().(*net.TCPAddr); OK && !tcpAddr.IP.IsLoopback() && !cfg.Auth {
+		log.Printf("warning: the server accepts connections from other machines without --auth, anyone reaching %s can read and change your sessions", listener.Addr())
+	}
+
 	srv := &http.Server{
-		Addr:    ":4000",
-		Handler: routes(),
+		Handler: routes(cfg),
 	}
+	// the event streams never go idle, they are ended for the shutdown not to wait for them
+	srv.RegisterOnShutdown(sessionEvents.close)
+	go sessionEvents.watch()
+	watchCtx, stopWatching := context.WithCancel(context.Background())
+	srv.RegisterOnShutdown(stopWatching)
+	go watchChanges(watchCtx)
 	shutdownErr := make(chan error)
 	go func() {
 		quit := make(chan os.Signal, 1)
@@ -160,8 +408,21 @@ func serve() error {
 		shutdownErr <- srv.Shutdown(ctx)
 	}()
 
-	log.Printf("starting server addr: %s\n", srv.Addr)
-	err := srv.ListenAndServe()
+	if cfg.Socket != "" {
+		log.Printf("starting server on the socket %s\n", cfg.Socket)
+	} else {
+		url := serverURL(listener.Addr())
+		log.Printf("starting server addr: %s\n", listener.Addr())
+		// printed on stdout so that scripts using --port 0 can read the port picked
+		fmt.Println(url)
+		if cfg.Open {
+			err = openBrowser(url)
+			if err != nil {
+				log.Printf("error opening the browser: %v", err)
+			}
+		}
+	}
+	err = srv.Serve(listener)
 	if !errors.Is(err, http.ErrServerClosed) {
 		return err
 	}
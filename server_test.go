@@ -0,0 +1,192 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testCSRFToken = "0123456789012345678901234567890123456789abc"
+
+// sessionRequest builds a request to the start or end route, with the csrf cookie and header when set
+func sessionRequest(method, target, cookie, header string) *http.Request {
+	form := url.Values{"activity": {"reading"}}
+	var r *http.Request
+	if method == http.MethodGet {
+		r = httptest.NewRequest(method, target+"?"+form.Encode(), nil)
+	} else {
+		r = httptest.NewRequest(method, target, strings.NewReader(form.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+	if cookie != "" {
+		r.AddCookie(&http.Cookie{Name: csrfCookieName, Value: cookie})
+	}
+	if header != "" {
+		r.Header.Set(csrfHeaderName, header)
+	}
+	return r
+}
+
+// prepareSessions records a finished session and, when active is set, starts another one
+func prepareSessions(t *testing.T, active bool) {
+	t.Helper()
+	mustAddSession(t, "writing", time.Now().Add(-3*time.Hour), 60)
+	if active {
+		_, err := startSession("programming")
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestSessionRoutesIgnoreGET(t *testing.T) {
+	for _, route := range []string{"/sessions/start", "/sessions/end"} {
+		t.Run(route, func(t *testing.T) {
+			useTestDB(t)
+			// start needs no active session and end one, so that a GET would have something to do
+			prepareSessions(t, route == "/sessions/end")
+			before := dumpSessions(t)
+
+			w := doRequest(routes(ServerConfig{}), sessionRequest(http.MethodGet, route, testCSRFToken, testCSRFToken))
+			if w.Code != http.StatusMethodNotAllowed {
+				t.Errorf("GET %s answered %d, want %d", route, w.Code, http.StatusMethodNotAllowed)
+			}
+			if after := dumpSessions(t); after != before {
+				t.Errorf("GET %s changed the sessions from\n%s\nto\n%s", route, before, after)
+			}
+		})
+	}
+}
+
+func TestSessionRoutesRequireCSRFToken(t *testing.T) {
+	cases := []struct {
+		name, cookie, header string
+	}{
+		{"no token", "", ""},
+		{"no cookie", "", testCSRFToken},
+		{"no header", testCSRFToken, ""},
+		{"wrong token", testCSRFToken, strings.Repeat("x", len(testCSRFToken))},
+	}
+	for _, route := range []string{"/sessions/start", "/sessions/end"} {
+		for _, c := range cases {
+			t.Run(route+" "+c.name, func(t *testing.T) {
+				useTestDB(t)
+				prepareSessions(t, route == "/sessions/end")
+				before := dumpSessions(t)
+
+				w := doRequest(routes(ServerConfig{}), sessionRequest(http.MethodPost, route, c.cookie, c.header))
+				if w.Code != http.StatusForbidden {
+					t.Errorf("POST %s answered %d, want %d", route, w.Code, http.StatusForbidden)
+				}
+				if after := dumpSessions(t); after != before {
+					t.Errorf("POST %s changed the sessions from\n%s\nto\n%s", route, before, after)
+				}
+			})
+		}
+	}
+}
+
+func TestSessionRoutesWithCSRFToken(t *testing.T) {
+	useTestDB(t)
+	handler := routes(ServerConfig{})
+
+	w := doRequest(handler, sessionRequest(http.MethodPost, "/sessions/start", testCSRFToken, testCSRFToken))
+	if w.Code != http.StatusOK {
+		t.Fatalf("starting a session answered %d: %s", w.Code, w.Body.String())
+	}
+	activity, err := getCurrentActiveSession()
+	if err != nil || activity != "reading" {
+		t.Fatalf("the active session is %q (%v), want reading", activity, err)
+	}
+
+	w = doRequest(handler, sessionRequest(http.MethodPost, "/sessions/end", testCSRFToken, testCSRFToken))
+	if w.Code != http.StatusOK {
+		t.Fatalf("ending the session answered %d: %s", w.Code, w.Body.String())
+	}
+	activity, _ = getCurrentActiveSession()
+	if activity != "" {
+		t.Fatalf("the session %q is still active", activity)
+	}
+}
+
+func TestRoutesRejectUnknownHosts(t *testing.T) {
+	useTestDB(t)
+	cases := []struct {
+		cfg     ServerConfig
+		host    string
+		allowed bool
+	}{
+		{ServerConfig{Addr: "127.0.0.1:4000"}, "localhost:4000", true},
+		{ServerConfig{Addr: "127.0.0.1:4000"}, "127.0.0.1:4000", true},
+		{ServerConfig{Addr: "127.0.0.1:4000"}, "[::1]:4000", true},
+		{ServerConfig{Addr: "127.0.0.1:4000"}, "dashboard.localhost", true},
+		{ServerConfig{Addr: "0.0.0.0:4000"}, "192.168.1.20:4000", true},
+		{ServerConfig{Addr: "laptop.lan:4000"}, "laptop.lan:4000", true},
+		// a rebound name of another site
+		{ServerConfig{Addr: "127.0.0.1:4000"}, "attacker.example:4000", false},
+		{ServerConfig{Addr: "127.0.0.1:4000"}, "localhost.attacker.example", false},
+		{ServerConfig{Addr: "127.0.0.1:4000"}, "", false},
+		{ServerConfig{Addr: "127.0.0.1:4000", Socket: "gotimeit.sock"}, "attacker.example", true},
+	}
+	for _, c := range cases {
+		for _, target := range []string{"/stats", "/api/v1/activities"} {
+			r := httptest.NewRequest(http.MethodGet, target, nil)
+			r.Host = c.host
+			w := doRequest(routes(c.cfg), r)
+			if allowed := w.Code != http.StatusForbidden; allowed != c.allowed {
+				t.Errorf("GET %s for the host %q of a server on %s answered %d", target, c.host, c.cfg.Addr, w.Code)
+			}
+		}
+	}
+
+	// with authentication the credentials protect the server whatever the host
+	r := httptest.NewRequest(http.MethodGet, "/api/v1/activities", nil)
+	r.Host = "attacker.example"
+	w := doRequest(routes(ServerConfig{Addr: "127.0.0.1:4000", Auth: true}), r)
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("an unauthenticated request answered %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+}
+
+func TestActivityChartHandlerRejectsInvalidYears(t *testing.T) {
+	useTestDB(t)
+	checkStatuses(t, routes(ServerConfig{}), map[string]int{
+		"/summary?year=abc":             http.StatusBadRequest,
+		"/summary?year=20x4":            http.StatusBadRequest,
+		"/summary?year=2024":            http.StatusOK,
+		"/summary?year=" + ROLLING_YEAR: http.StatusOK,
+		"/summary":                      http.StatusOK,
+	})
+}
+
+func TestActivityChartHandlerDefaultsToRollingYear(t *testing.T) {
+	useTestDB(t)
+	handler := routes(ServerConfig{})
+	selected := fmt.Sprintf(`<option value="%s" selected>`, ROLLING_YEAR)
+	for target, want := range map[string]bool{
+		"/summary":                      true,
+		"/summary?year=" + ROLLING_YEAR: true,
+		"/summary?year=2024":            false,
+	} {
+		w := doRequest(handler, httptest.NewRequest(http.MethodGet, target, nil))
+		if got := strings.Contains(w.Body.String(), selected); got != want {
+			t.Errorf("GET %s selects the last 12 months: %t, want %t", target, got, want)
+		}
+	}
+}
+
+func TestCompareHandlerValidatesPeriods(t *testing.T) {
+	useTestDB(t)
+	checkStatuses(t, routes(ServerConfig{}), map[string]int{
+		"/compare?period=day":   http.StatusBadRequest,
+		"/compare?period=Week":  http.StatusBadRequest,
+		"/compare?period=week":  http.StatusOK,
+		"/compare?period=month": http.StatusOK,
+		"/compare?period=year":  http.StatusOK,
+		"/compare":              http.StatusOK,
+	})
+}
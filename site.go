@@ -0,0 +1,92 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+)
+
+// buildSite writes a read-only copy of the summary dashboard to dir: index.html charting the last
+// 12 months, <year>.html for every year with sessions, segments/<date>.json for every day with
+// sessions and the stylesheets in static. Links are relative so the site can be hosted from any path
+func buildSite(dir string) (int, int, error) {
+	err := setYearsOptions()
+	if err != nil {
+		return 0, 0, err
+	}
+	err = os.MkdirAll(filepath.Join(dir, "segments"), 0755)
+	if err != nil {
+		return 0, 0, err
+	}
+	// the pages link to the hashed names of the assets, which a host can cache for good
+	for name, asset := range staticAssets {
+		if name != asset.HashedName {
+			continue
+		}
+		assetFile := filepath.Join(dir, "static", filepath.FromSlash(name))
+		err = os.MkdirAll(filepath.Dir(assetFile), 0755)
+		if err != nil {
+			return 0, 0, err
+		}
+		err = os.WriteFile(assetFile, asset.Content, 0644)
+		if err != nil {
+			return 0, 0, err
+		}
+	}
+
+	pages := map[string]string{"index.html": ROLLING_YEAR}
+	for _, year := range getYearOptions() {
+		pages[year+".html"] = year
+	}
+	for page, year := range pages {
+		chartData, err := computeChartDataForYear(year, nil)
+		if err != nil {
+			return 0, 0, err
+		}
+		chartData.ReadOnly = true
+		pageBytes, err := renderHomepage(&TemplateData{CurrentYearActivityChartData: chartData, ReadOnly: true})
+		if err != nil {
+			return 0, 0, err
+		}
+		err = os.WriteFile(filepath.Join(dir, page), pageBytes, 0644)
+		if err != nil {
+			return 0, 0, err
+		}
+	}
+
+	// sessions come ordered by their start, so the sessions of a day follow each other
+	days := 0
+	date := ""
+	segments := make([]Segment, 0)
+	writeSegments := func() error {
+		if date == "" {
+			return nil
+		}
+		days++
+		js, err := json.Marshal(envelope{"Segments": segments})
+		if err != nil {
+			return err
+		}
+		return os.WriteFile(filepath.Join(dir, "segments", date+".json"), js, 0644)
+	}
+	err = forEachSessionBetween("0001-01-01", "9999-12-31", nil, func(session Session) error {
+		if session.Date != date {
+			err := writeSegments()
+			if err != nil {
+				return err
+			}
+			date = session.Date
+			segments = segments[:0]
+		}
+		segments = append(segments, Segment{Activity: session.Activity, Start: session.Start.Unix(), End: session.End.Unix()})
+		return nil
+	})
+	if err != nil {
+		return 0, 0, err
+	}
+	err = writeSegments()
+	if err != nil {
+		return 0, 0, err
+	}
+	return len(pages), days, nil
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBuildSiteEscapesActivityNames(t *testing.T) {
+	useTestDB(t)
+	activity := "<script>alert(1)</script>"
+	mustAddSession(t, activity, time.Now().Add(-3*time.Hour), 90)
+
+	out := t.TempDir()
+	pages, days, err := buildSite(out)
+	if err != nil {
+		t.Fatalf("building the site: %v", err)
+	}
+	if pages < 2 || days != 1 {
+		t.Fatalf("got %d pages and %d days, want at least 2 pages and 1 day", pages, days)
+	}
+
+	files, err := filepath.Glob(filepath.Join(out, "*.html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, file := range files {
+		page, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if strings.Contains(string(page), activity) {
+			t.Errorf("%s contains the activity name unescaped", filepath.Base(file))
+		}
+		// the tooltip is html inside an attribute, so the name is escaped twice
+		if !strings.Contains(string(page), "&amp;lt;script&amp;gt;alert(1)&amp;lt;/script&amp;gt;") {
+			t.Errorf("%s doesn't show the activity in the tooltip of its day", filepath.Base(file))
+		}
+	}
+}
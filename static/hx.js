@@ -0,0 +1,93 @@
+// hx.js is only served until htmx itself is vendored with go generate. It implements the few htmx
+// attributes the dashboard uses and nothing else, templates needing more of htmx require the real one:
+//   hx-get / hx-post   request the url with the values of the element's form
+//   hx-trigger         submit (forms), change (form fields) or load, click otherwise
+//   hx-target          css selector of the element whose content is replaced, the element itself by default
+//   hx-headers         json object of headers sent by the requests of the element and its descendants
+// Like htmx, requests send the HX-Request header, a HX-Redirect response header changes the page
+// and error responses don't replace anything.
+(function () {
+  "use strict";
+
+  function defaultTrigger(el) {
+    if (el.tagName === "FORM") return "submit";
+    if (["INPUT", "SELECT", "TEXTAREA"].includes(el.tagName)) return "change";
+    return "click";
+  }
+
+  function headersFor(el) {
+    const headers = { "HX-Request": "true" };
+    const chain = [];
+    for (let node = el; node && node.getAttribute; node = node.parentElement) {
+      chain.unshift(node);
+    }
+    // closer elements override the headers of their ancestors
+    for (const node of chain) {
+      const value = node.getAttribute("hx-headers");
+      if (!value) continue;
+      try {
+        Object.assign(headers, JSON.parse(value));
+      } catch (e) {
+        console.error("hx: invalid hx-headers", value, e);
+      }
+    }
+    return headers;
+  }
+
+  async function issue(el) {
+    const method = el.hasAttribute("hx-post") ? "POST" : "GET";
+    const url = new URL(el.getAttribute(method === "POST" ? "hx-post" : "hx-get"), window.location.href);
+    const form = el.tagName === "FORM" ? el : el.closest("form");
+    const values = form ? new URLSearchParams(new FormData(form)) : new URLSearchParams();
+    const options = { method: method, headers: headersFor(el) };
+    if (method === "GET") {
+      for (const [name, value] of values) url.searchParams.append(name, value);
+    } else {
+      options.body = values;
+    }
+
+    let res;
+    try {
+      res = await fetch(url, options);
+    } catch (e) {
+      console.error("hx: request failed", url.toString(), e);
+      return;
+    }
+    const redirect = res.headers.get("HX-Redirect");
+    if (redirect) {
+      window.location.href = redirect;
+      return;
+    }
+    if (!res.ok) {
+      console.error("hx: " + method + " " + url.pathname + " returned " + res.status, await res.text());
+      return;
+    }
+    const selector = el.getAttribute("hx-target");
+    const target = selector ? document.querySelector(selector) : el;
+    if (!target) return;
+    target.innerHTML = await res.text();
+    process(target);
+  }
+
+  // process wires the hx- attributes of root and its descendants, elements are only wired once
+  function process(root) {
+    const elements = Array.from(root.querySelectorAll("[hx-get],[hx-post]"));
+    if (root.matches && root.matches("[hx-get],[hx-post]")) elements.unshift(root);
+    for (const el of elements) {
+      if (el.hxProcessed) continue;
+      el.hxProcessed = true;
+      const trigger = (el.getAttribute("hx-trigger") || defaultTrigger(el)).trim();
+      if (trigger === "load") {
+        issue(el);
+        continue;
+      }
+      el.addEventListener(trigger, (e) => {
+        e.preventDefault();
+        issue(el);
+      });
+    }
+  }
+
+  window.hx = { process: process };
+  document.addEventListener("DOMContentLoaded", () => process(document.body));
+})();
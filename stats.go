@@ -0,0 +1,144 @@
+package main
+
+import (
+	"sort"
+	"time"
+)
+
+// session lengths are grouped into these buckets, each one ends where the next one starts
+var lengthBuckets = []struct {
+	Label string
+	Upto  time.Duration
+}{
+	{"< 15 min", 15 * time.Minute},
+	{"15-30 min", 30 * time.Minute},
+	{"30-60 min", time.Hour},
+	{"1-2 hr", 2 * time.Hour},
+	{"2-4 hr", 4 * time.Hour},
+	{"4+ hr", 0},
+}
+
+// computeStatistics builds the time-of-day and weekday statistics
+// for the sessions dated between from and to (inclusive)
+func computeStatistics(from, to string, activities []string) (*Statistics, error) {
+	activities = normalizeActivities(activities)
+	sessions, err := getSessionsBetween(from, to, activities)
+	if err != nil {
+		return nil, err
+	}
+	weekStart, err := getWeekStart()
+	if err != nil {
+		return nil, err
+	}
+
+	stats := &Statistics{
+		From:               from,
+		To:                 to,
+		Activities:         activities,
+		SessionCount:       len(sessions),
+		PunchCardWeekdays:  make([]string, 7),
+		LengthDistribution: make([]LengthBucket, len(lengthBuckets)),
+	}
+	for row := range stats.PunchCardWeekdays {
+		stats.PunchCardWeekdays[row] = time.Weekday((int(weekStart) + row) % 7).String()[:3]
+	}
+	for i, bucket := range lengthBuckets {
+		stats.LengthDistribution[i].Label = bucket.Label
+	}
+
+	var total time.Duration
+	startMinutes := make([]int, 0, len(sessions))
+	longest := make(map[string]Session)
+	for _, session := range sessions {
+		duration := session.Duration()
+		total += duration
+		startMinutes = append(startMinutes, session.Start.Hour()*60+session.Start.Minute())
+
+		if l, OK := longest[session.Activity]; !OK || duration > l.Duration() {
+			longest[session.Activity] = session
+		}
+
+		for i, bucket := range lengthBuckets {
+			if bucket.Upto == 0 || duration < bucket.Upto {
+				stats.LengthDistribution[i].Count++
+				break
+			}
+		}
+
+		splitByHour(session, func(hourStart time.Time, minutes float64) {
+			row := weekdayRow(hourStart.Weekday(), weekStart)
+			stats.PunchCard[row][hourStart.Hour()] += minutes
+		})
+	}
+
+	stats.TotalDurationStr = formatDuration(total)
+	if len(sessions) > 0 {
+		stats.AverageDurationStr = formatDuration(total / time.Duration(len(sessions)))
+
+		sort.Ints(startMinutes)
+		median := startMinutes[len(startMinutes)/2]
+		if len(startMinutes)%2 == 0 {
+			median = (startMinutes[len(startMinutes)/2-1] + median) / 2
+		}
+		stats.MedianStart = time.Date(0, 1, 1, median/60, median%60, 0, 0, time.UTC).Format("15:04")
+
+		for i := range stats.LengthDistribution {
+			stats.LengthDistribution[i].Percentage = stats.LengthDistribution[i].Count * 100 / len(sessions)
+		}
+	}
+
+	var busiest float64
+	for row := range stats.PunchCard {
+		for hour := range stats.PunchCard[row] {
+			busiest = max(busiest, stats.PunchCard[row][hour])
+		}
+	}
+	for row := range stats.PunchCard {
+		for hour, minutes := range stats.PunchCard[row] {
+			stats.PunchCardLevels[row][hour] = punchCardLevel(minutes, busiest)
+		}
+	}
+
+	stats.LongestSessions = make([]LongestSession, 0, len(longest))
+	for _, session := range longest {
+		stats.LongestSessions = append(stats.LongestSessions, LongestSession{
+			Activity:    session.Activity,
+			Date:        session.Date,
+			Start:       session.Start.Format("15:04"),
+			End:         session.End.Format("15:04"),
+			DurationStr: formatDuration(session.Duration()),
+			duration:    session.Duration(),
+		})
+	}
+	sort.Slice(stats.LongestSessions, func(i, j int) bool {
+		if stats.LongestSessions[i].duration == stats.LongestSessions[j].duration {
+			return stats.LongestSessions[i].Activity < stats.LongestSessions[j].Activity
+		}
+		return stats.LongestSessions[i].duration > stats.LongestSessions[j].duration
+	})
+
+	return stats, nil
+}
+
+// splitByHour calls fn with the minutes of the session falling in every hour of the day it spans,
+// hourStart being the time within that hour at which the session's part starts
+func splitByHour(session Session, fn func(hourStart time.Time, minutes float64)) {
+	for current := session.Start; current.Before(session.End); {
+		y, m, d := current.Date()
+		next := time.Date(y, m, d, current.Hour()+1, 0, 0, 0, current.Location())
+		if next.After(session.End) {
+			next = session.End
+		}
+		fn(current, next.Sub(current).Minutes())
+		current = next
+	}
+}
+
+// punchCardLevel scales the minutes tracked in an hour slot to 0-4 relative to the busiest slot
+func punchCardLevel(minutes, busiest float64) int {
+	if minutes == 0 || busiest == 0 {
+		return 0
+	}
+	level := int(minutes*4/busiest + 0.999)
+	return min(max(level, 1), 4)
+}
@@ -0,0 +1,277 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// colors of the heatmap levels returned by getLevel, those of the light theme of the web page
+// and the default of heatmap and badge
+var levelColors = []string{"#ebedf0", "#68ee59", "#3fde26", "#38ae50", "#196c2a", "#034b11", "#000a02"}
+
+// characters standing in for the heatmap levels when colors can't be used, one per level
+// so that none of them is lost
+var (
+	levelShades = []string{"·", "▂", "▃", "▄", "▅", "▆", "█"}
+	levelASCII  = []string{".", ":", "-", "=", "+", "*", "#"}
+)
+
+type colorMode int
+
+const (
+	colorModeASCII colorMode = iota
+	colorModeShades
+	colorMode256
+	colorModeTrueColor
+)
+
+// detectColorMode picks the richest output stdout supports. --no-color always falls back to plain
+// ASCII, NO_COLOR, a dumb terminal or output that isn't a terminal fall back to Unicode shading
+func detectColorMode(noColor bool) colorMode {
+	if noColor {
+		return colorModeASCII
+	}
+	if _, OK := os.LookupEnv("NO_COLOR"); OK || os.Getenv("TERM") == "dumb" || !isTerminal(os.Stdout) {
+		return colorModeShades
+	}
+	switch os.Getenv("COLORTERM") {
+	case "truecolor", "24bit":
+		return colorModeTrueColor
+	}
+	return colorMode256
+}
+
+func isTerminal(f *os.File) bool {
+	fi, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return fi.Mode()&os.ModeCharDevice != 0
+}
+
+// hexToRGB converts a #rrggbb or #rgb color into its components
+func hexToRGB(hex string) (int, int, int) {
+	hex = strings.TrimPrefix(hex, "#")
+	if len(hex) == 3 {
+		hex = string([]byte{hex[0], hex[0], hex[1], hex[1], hex[2], hex[2]})
+	}
+	v, err := strconv.ParseUint(hex, 16, 32)
+	if err != nil {
+		return 0, 0, 0
+	}
+	return int(v >> 16 & 0xff), int(v >> 8 & 0xff), int(v & 0xff)
+}
+
+// colorize paints s with the foreground color hex, approximated on the 6x6x6 cube of 256 color terminals
+func colorize(s, hex string, mode colorMode) string {
+	r, g, b := hexToRGB(hex)
+	switch mode {
+	case colorModeTrueColor:
+		return fmt.Sprintf("\x1b[38;2;%d;%d;%dm%s\x1b[0m", r, g, b, s)
+	case colorMode256:
+		cube := func(c int) int { return (c*5 + 127) / 255 }
+		return fmt.Sprintf("\x1b[38;5;%dm%s\x1b[0m", 16+36*cube(r)+6*cube(g)+cube(b), s)
+	default:
+		return s
+	}
+}
+
+// levelCell returns the glyph of a heatmap cell of the given level, painted with color in the color modes
+func levelCell(level int, color string, mode colorMode) string {
+	switch mode {
+	case colorModeASCII:
+		return levelASCII[level]
+	case colorModeShades:
+		return levelShades[level]
+	default:
+		return colorize("■", color, mode)
+	}
+}
+
+// renderTerminalHeatmap draws the chart as week columns, two characters wide, with month labels
+// above them, weekday labels on the left and a legend below
+func renderTerminalHeatmap(acd *ActivityChartData, theme heatmapTheme, mode colorMode) string {
+	const labelWidth = 4
+	var sb strings.Builder
+
+	fmt.Fprintf(&sb, "Activity Tracker for %s", acd.Title)
+	if len(acd.Activities) > 0 {
+		fmt.Fprintf(&sb, " (%s)", strings.Join(acd.Activities, ", "))
+	}
+	sb.WriteString("\n\n")
+
+	months := []rune(strings.Repeat(" ", labelWidth+len(acd.Weeks)*2))
+	for _, ml := range acd.MonthLabels {
+		copy(months[labelWidth+ml.Column*2:], []rune(ml.Label))
+	}
+	sb.WriteString(strings.TrimRight(string(months), " "))
+	sb.WriteString("\n")
+
+	for row := 0; row < 7; row++ {
+		fmt.Fprintf(&sb, "%-*s", labelWidth, acd.WeekdayLabels[row])
+		for _, week := range acd.Weeks {
+			if week[row] == nil {
+				sb.WriteString("  ")
+				continue
+			}
+			sb.WriteString(levelCell(week[row].Level, theme.dayColor(week[row]), mode))
+			sb.WriteString(" ")
+		}
+		sb.WriteString("\n")
+	}
+
+	sb.WriteString("\n")
+	sb.WriteString(strings.Repeat(" ", labelWidth))
+	sb.WriteString("Less ")
+	for level, color := range theme.Levels {
+		sb.WriteString(levelCell(level, color, mode))
+		sb.WriteString(" ")
+	}
+	sb.WriteString("More\n")
+	return sb.String()
+}
+
+// colors given to the activities of the day timeline, in the order the activities are listed
+var timelineColors = []string{"#4caf50", "#2196f3", "#ff9800", "#e91e63", "#9c27b0", "#00bcd4", "#ffc107", "#795548"}
+
+// symbols standing in for the timeline colors when colors can't be used
+var timelineSymbols = []string{"#", "=", "+", "*", "%", "@", "&", "$"}
+
+// each character of the timeline bar covers 15 minutes of the day
+const timelineSlots = 96
+
+// renderTerminalTimeline draws the day's segments as a 24 hour bar with hour markers, followed by
+// the list of segments and the untracked gaps between them
+func renderTerminalTimeline(date string, segments []Segment, mode colorMode) (string, error) {
+	day, err := time.ParseInLocation("2006-01-02", date, time.Local)
+	if err != nil {
+		return "", fmt.Errorf("invalid date %q, expected yyyy-mm-dd", date)
+	}
+	dayStart, dayEnd := day, day.AddDate(0, 0, 1)
+
+	// segments are clamped to the day, like the bar on the web page does
+	type span struct {
+		activity   string
+		start, end time.Time
+	}
+	spans := make([]span, 0, len(segments))
+	totals := make(map[string]time.Duration)
+	for _, segment := range segments {
+		start, end := time.Unix(segment.Start, 0), time.Unix(segment.End, 0)
+		if start.Before(dayStart) {
+			start = dayStart
+		}
+		if end.After(dayEnd) {
+			end = dayEnd
+		}
+		if !end.After(start) {
+			continue
+		}
+		spans = append(spans, span{segment.Activity, start, end})
+		totals[segment.Activity] += end.Sub(start)
+	}
+	sort.Slice(spans, func(i, j int) bool { return spans[i].start.Before(spans[j].start) })
+
+	activities := make([]string, 0, len(totals))
+	for activity := range totals {
+		activities = append(activities, activity)
+	}
+	sort.Strings(activities)
+	glyphs := make(map[string]string)
+	for i, activity := range activities {
+		if mode == colorModeASCII || mode == colorModeShades {
+			glyphs[activity] = timelineSymbols[i%len(timelineSymbols)]
+		} else {
+			glyphs[activity] = colorize("█", timelineColors[i%len(timelineColors)], mode)
+		}
+	}
+
+	// every slot shows the activity taking up most of its 15 minutes
+	slotLength := 24 * time.Hour / timelineSlots
+	bar := make([]string, timelineSlots)
+	for slot := range bar {
+		slotStart := dayStart.Add(time.Duration(slot) * slotLength)
+		slotEnd := slotStart.Add(slotLength)
+		var longest time.Duration
+		bar[slot] = "·"
+		for _, s := range spans {
+			overlap := minTime(s.end, slotEnd).Sub(maxTime(s.start, slotStart))
+			if overlap > longest {
+				longest = overlap
+				bar[slot] = glyphs[s.activity]
+			}
+		}
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "Timeline for %s\n\n", day.Format("Mon, Jan 02, 2006"))
+	hours := []rune(strings.Repeat(" ", timelineSlots+2))
+	ticks := []rune(strings.Repeat(" ", timelineSlots+1))
+	for hour := 0; hour <= 24; hour++ {
+		position := hour * timelineSlots / 24
+		if hour%3 == 0 {
+			copy(hours[position:], []rune(strconv.Itoa(hour)))
+			ticks[position] = '|'
+		} else {
+			ticks[position] = '\''
+		}
+	}
+	sb.WriteString(strings.TrimRight(string(hours), " "))
+	sb.WriteString("\n")
+	sb.WriteString(string(ticks))
+	sb.WriteString("\n")
+	sb.WriteString(strings.Join(bar, ""))
+	sb.WriteString("\n\n")
+
+	for _, activity := range activities {
+		fmt.Fprintf(&sb, "%s %s: %s\n", glyphs[activity], activity, formatDuration(totals[activity]))
+	}
+	sb.WriteString("· untracked\n\n")
+
+	// the list ends now for today so that the rest of the day isn't reported as untracked
+	end := dayEnd
+	if now := time.Now(); now.After(dayStart) && now.Before(dayEnd) {
+		end = now
+	}
+	cursor := dayStart
+	writeRow := func(start, end time.Time, label string) {
+		fmt.Fprintf(&sb, "%s - %s  %-20s %s\n", start.Format("15:04"), formatClock(end, dayStart), label, formatDuration(end.Sub(start)))
+	}
+	for _, s := range spans {
+		if s.start.Sub(cursor) >= time.Minute {
+			writeRow(cursor, s.start, "untracked")
+		}
+		writeRow(s.start, s.end, s.activity)
+		cursor = maxTime(cursor, s.end)
+	}
+	if end.Sub(cursor) >= time.Minute {
+		writeRow(cursor, end, "untracked")
+	}
+	return sb.String(), nil
+}
+
+// formatClock formats t as HH:MM, midnight ending the day starting at dayStart is shown as 24:00
+func formatClock(t, dayStart time.Time) string {
+	if t.Equal(dayStart.AddDate(0, 0, 1)) {
+		return "24:00"
+	}
+	return t.Format("15:04")
+}
+
+func minTime(a, b time.Time) time.Time {
+	if a.Before(b) {
+		return a
+	}
+	return b
+}
+
+func maxTime(a, b time.Time) time.Time {
+	if a.After(b) {
+		return a
+	}
+	return b
+}
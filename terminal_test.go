@@ -0,0 +1,60 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLevelGlyphsAreDistinct(t *testing.T) {
+	for name, glyphs := range map[string][]string{"shades": levelShades, "ascii": levelASCII} {
+		if len(glyphs) != maxLevel+1 {
+			t.Errorf("%s has %d glyphs for %d levels", name, len(glyphs), maxLevel+1)
+		}
+		seen := make(map[string]int)
+		for level, glyph := range glyphs {
+			if previous, OK := seen[glyph]; OK {
+				t.Errorf("%s uses %q for the levels %d and %d", name, glyph, previous, level)
+			}
+			seen[glyph] = level
+		}
+	}
+}
+
+func TestHeatmapsUsePalettes(t *testing.T) {
+	useTestDB(t)
+	err := setSetting(SETTING_PALETTE_PREFIX+"reading", "#f0a,#222222,#333333,#444444,#555555,#666666")
+	if err != nil {
+		t.Fatal(err)
+	}
+	mustAddSession(t, "reading", time.Now().AddDate(0, 0, -2).Truncate(24*time.Hour).Add(8*time.Hour), 30)
+	chartData, err := computeChartDataForYear(ROLLING_YEAR, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"light", "dark", "high-contrast"} {
+		theme := heatmapThemes[name]
+		if len(theme.Levels) != maxLevel+1 {
+			t.Fatalf("the %s theme has %d colors for %d levels", name, len(theme.Levels), maxLevel+1)
+		}
+		heatmap := renderTerminalHeatmap(chartData, theme, colorModeTrueColor)
+		if !strings.Contains(heatmap, "\x1b[38;2;255;0;170m■") {
+			t.Errorf("the %s terminal heatmap doesn't paint the day with the palette of its activity", name)
+		}
+		if !strings.Contains(heatmap, colorize("■", theme.Levels[0], colorModeTrueColor)) {
+			t.Errorf("the %s terminal heatmap doesn't paint the empty days with the theme", name)
+		}
+
+		badge, err := renderBadge(computeBadgeData(chartData, theme, defaultBadgeCell))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(string(badge), `fill="#f0a"`) {
+			t.Errorf("the %s badge doesn't paint the day with the palette of its activity", name)
+		}
+		if !strings.Contains(string(badge), `fill="`+theme.Background+`"`) {
+			t.Errorf("the %s badge doesn't use the background of the theme", name)
+		}
+	}
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+// Sessions in the timeclock format of ledger and hledger are a clock-in line naming the account and
+// a clock-out line, activities with colons like work:gotimeit become hierarchical accounts
+//
+//	i 2026-10-18 09:00:00 programming
+//	o 2026-10-18 10:30:00
+
+const timeclockLayout = "2006-01-02 15:04:05"
+
+// timeclockAccount makes an activity a valid account name, two spaces would end it
+// and start the description of the entry
+func timeclockAccount(activity string) string {
+	return strings.Join(strings.Fields(activity), " ")
+}
+
+type timeclockExporter struct {
+	w io.Writer
+}
+
+func newTimeclockExporter(w io.Writer) exporter {
+	return &timeclockExporter{w: w}
+}
+
+func (e *timeclockExporter) WriteSession(session Session) error {
+	_, err := fmt.Fprintf(e.w, "i %s %s\no %s\n\n",
+		session.Start.Format(timeclockLayout), timeclockAccount(session.Activity), session.End.Format(timeclockLayout))
+	return err
+}
+
+func (e *timeclockExporter) WriteDailyTotal(total ActivitySession) error {
+	return errors.New("the timeclock format holds sessions, not daily totals")
+}
+
+func (e *timeclockExporter) Close() error {
+	return nil
+}
+
+var timeclockDateLayouts = []string{"2006-01-02", "2006/01/02", "2006.01.02"}
+
+var timeclockTimeLayouts = []string{"15:04:05", "15:04"}
+
+// nextField cuts the first space separated field of s
+func nextField(s string) (string, string) {
+	field, rest, _ := strings.Cut(strings.TrimLeft(s, " "), " ")
+	return field, rest
+}
+
+// parseTimeclockEntry parses what follows the code of an entry, returning its time and the rest as is
+func parseTimeclockEntry(entry string) (time.Time, string, error) {
+	dateStr, rest := nextField(entry)
+	clockStr, rest := nextField(rest)
+	var date, clock time.Time
+	var err error
+	for _, layout := range timeclockDateLayouts {
+		date, err = time.ParseInLocation(layout, dateStr, time.Local)
+		if err == nil {
+			break
+		}
+	}
+	if err != nil {
+		return time.Time{}, "", fmt.Errorf("invalid date %q", dateStr)
+	}
+	for _, layout := range timeclockTimeLayouts {
+		clock, err = time.Parse(layout, clockStr)
+		if err == nil {
+			break
+		}
+	}
+	if err != nil {
+		return time.Time{}, "", fmt.Errorf("invalid time %q", clockStr)
+	}
+	t := time.Date(date.Year(), date.Month(), date.Day(), clock.Hour(), clock.Minute(), clock.Second(), 0, time.Local)
+
+	// an optional utc offset follows the time
+	zone, afterZone := nextField(rest)
+	if len(zone) == 5 && (zone[0] == '+' || zone[0] == '-') {
+		offset, err := time.Parse("-0700", zone)
+		if err != nil {
+			return time.Time{}, "", fmt.Errorf("invalid time zone %q", zone)
+		}
+		_, seconds := offset.Zone()
+		t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), 0, time.FixedZone(zone, seconds)).Local()
+		rest = afterZone
+	}
+	return t, strings.TrimLeft(rest, " "), nil
+}
+
+// readTimeclock reads clock-in and clock-out pairs of a timeclock file, the account of a clock-in
+// becomes the activity and its description, after two spaces, the description of the session
+func readTimeclock(filename string, opts importOptions) ([]importRecord, []string, []string, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	defer f.Close()
+
+	records := make([]importRecord, 0)
+	invalid := make([]string, 0)
+	skipped := make([]string, 0)
+	var open *importRecord
+	row := 0
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		row++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		code, entry, _ := strings.Cut(line, " ")
+		switch code {
+		case "i", "I":
+			if open != nil {
+				invalid = append(invalid, fmt.Sprintf("row %d: clocked in again before clocking out", open.Row))
+			}
+			start, rest, err := parseTimeclockEntry(strings.ReplaceAll(entry, "\t", "  "))
+			if err != nil {
+				invalid = append(invalid, fmt.Sprintf("row %d: %v", row, err))
+				open = nil
+				continue
+			}
+			// the account ends at two spaces, the description follows
+			account, description, _ := strings.Cut(rest, "  ")
+			record := &importRecord{
+				Row:         row,
+				Start:       start,
+				Activity:    strings.TrimSpace(account),
+				Description: strings.TrimSpace(description),
+			}
+			open = record
+		case "o", "O":
+			end, _, err := parseTimeclockEntry(entry)
+			if err != nil {
+				invalid = append(invalid, fmt.Sprintf("row %d: %v", row, err))
+				open = nil
+				continue
+			}
+			if open == nil {
+				invalid = append(invalid, fmt.Sprintf("row %d: clocked out without clocking in", row))
+				continue
+			}
+			open.End = end
+			records = append(records, *open)
+			open = nil
+		default:
+			// comments, and the h and b codes of timeclock.el, aren't sessions
+			if !strings.ContainsAny(code[:1], ";#*") {
+				skipped = append(skipped, fmt.Sprintf("row %d: %q entry", row, code))
+			}
+		}
+	}
+	if open != nil {
+		skipped = append(skipped, fmt.Sprintf("row %d: still clocked in", open.Row))
+	}
+	return records, invalid, skipped, scanner.Err()
+}